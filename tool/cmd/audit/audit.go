@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewAuditCommand() *cobra.Command {
+	var offline bool
+	var severity string
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Checks the installed functions against the advisories in the catalogs and advisory feeds",
+		Long: `Checks the installed functions against the advisories published in the
+catalogs and in the advisory feeds listed under advisories in the config.
+Exits with status 1 if any installed version is affected.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if kaffine.SeverityRank(severity) == len(kaffine.AdvisorySeverities) {
+				return fmt.Errorf("unknown severity '%s' (expected one of %s)", severity, strings.Join(kaffine.AdvisorySeverities, "|"))
+			}
+
+			catman := kaffine.Fm.CatMan
+			if !offline {
+				var errs map[string]error
+				catman, errs = kaffine.Fm.CatMan.FetchLatest(kaffine.Fm.CatMan.URIs)
+				for _, uri := range kaffine.Fm.CatMan.URIs {
+					if err, ok := errs[uri]; ok {
+						fmt.Fprintln(kaffine.Stderr, err)
+					}
+				}
+			}
+
+			report := kaffine.Fm.Audit(catman).FilterSeverity(severity)
+			if err := kaffine.Print(cmd.OutOrStdout(), report); err != nil {
+				return err
+			}
+
+			if n := len(report.Findings); n > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &kaffine.ExitError{Code: 1, Err: fmt.Errorf("%d advisory finding(s) for the installed functions", n)}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&offline, "offline", false, "Use the cached catalogs instead of fetching them again, advisory feeds are still fetched")
+	cmd.Flags().StringVar(&severity, "severity", "low", "Only report advisories at least this severe, one of "+strings.Join(kaffine.AdvisorySeverities, "|"))
+
+	return cmd
+}
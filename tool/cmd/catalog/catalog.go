@@ -0,0 +1,52 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCatalogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Tools for publishing catalogs",
+	}
+
+	var keyFile string
+	sign := &cobra.Command{
+		Use:         "sign [catalog file]",
+		Short:       "Writes a detached signature for a catalog file next to it, as <file>" + kaffine.SignatureSuffix,
+		Annotations: map[string]string{kaffine.StandaloneCommand: "true"},
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := os.ReadFile(keyFile)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+
+			sig, err := kaffine.SignCatalog(data, key)
+			if err != nil {
+				return err
+			}
+			if err = os.WriteFile(args[0]+kaffine.SignatureSuffix, sig, 0644); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(kaffine.Stderr, "Wrote %s\n", args[0]+kaffine.SignatureSuffix)
+			return nil
+		},
+	}
+	sign.Flags().StringVar(&keyFile, "key", "", "PEM file with the ed25519 or ECDSA private key to sign with")
+	sign.MarkFlagRequired("key")
+
+	cmd.AddCommand(sign)
+
+	return cmd
+}
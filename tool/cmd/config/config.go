@@ -1,12 +1,9 @@
 package config
 
 import (
-	"fmt"
-
 	"kaffine-mod/kaffine"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
 // support both local and global config
@@ -30,9 +27,7 @@ func NewConfigCommand() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("Successfully added catalog\"%s\"", uri)
-
-			return nil
+			return kaffine.Print(cmd.OutOrStdout(), kaffine.CatalogResult{Action: "added", Catalog: uri})
 		},
 	}
 
@@ -46,25 +41,21 @@ func NewConfigCommand() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("Successfully removed catalog\"%s\"", uri)
-
-			return nil
+			return kaffine.Print(cmd.OutOrStdout(), kaffine.CatalogResult{Action: "removed", Catalog: uri})
 		},
 	}
 
 	listConfig := &cobra.Command{
-		Use:   "list",
-		Short: "Lists current configuration",
+		Use:         "list",
+		Short:       "Lists current configuration",
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			kaffine.Fm.UpdateConfig()
-			data, err := yaml.Marshal(kaffine.Fm.Cfg)
-			if err != nil {
-				return err
-			}
-
-			fmt.Println(string(data))
 
-			return nil
+			return kaffine.Print(cmd.OutOrStdout(), kaffine.ConfigResult{
+				Catalogs:     kaffine.Fm.Cfg.Catalogs,
+				KrmFunctions: kaffine.Fm.Cfg.Dependencies.KrmFunctions,
+			})
 		},
 	}
 
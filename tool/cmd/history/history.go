@@ -0,0 +1,26 @@
+package history
+
+import (
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "history",
+		Short:       "Lists the operations that changed installed functions or catalogs",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			h, err := kaffine.Fm.History()
+			if err != nil {
+				return err
+			}
+
+			return kaffine.Print(cmd.OutOrStdout(), h)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,26 @@
+package info
+
+import (
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewInfoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "info [group/Kind]",
+		Short:       "Shows details and all available versions of a function",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := kaffine.Fm.Info(args[0])
+			if err != nil {
+				return err
+			}
+
+			return kaffine.Print(cmd.OutOrStdout(), info)
+		},
+	}
+
+	return cmd
+}
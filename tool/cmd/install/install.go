@@ -9,21 +9,60 @@ import (
 )
 
 func NewInstallCommand() *cobra.Command {
+	var keepGoing bool
+
 	cmd := &cobra.Command{
-		Use:   "install [name]",
-		Short: "Searches the managed catalogs for a function with the specified name, and installs it",
+		Use:   "install [name]...",
+		Short: "Searches the managed catalogs for functions with the specified names, and installs them",
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fname := args[len(args)-1]
-			fn, err := kaffine.Fm.AddFunctionDefinition(fname)
-			if err != nil {
+			if kaffine.Interactive() {
+				kaffine.Fm.Picker = kaffine.Choose
+			}
+
+			results, err := kaffine.Fm.AddFunctionDefinitions(args, keepGoing)
+			if err := kaffine.Print(cmd.OutOrStdout(), results); err != nil {
 				return err
 			}
+			warn(results)
+			if err == nil {
+				return nil
+			}
 
-			fmt.Println("Successfully added KRM Function '" + fn.GroupName() + "'")
+			for _, e := range results.Errors() {
+				fmt.Fprintln(kaffine.Stderr, e)
+			}
+			if !keepGoing {
+				err = fmt.Errorf("%v, nothing was installed", err)
+			}
 
-			return nil
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &kaffine.ExitError{Code: 1, Err: err, Save: keepGoing}
 		},
 	}
 
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Still install the functions that can be installed when others fail")
+
 	return cmd
 }
+
+// Functions that did get installed in a deprecated or yanked version, or one
+// with known problems
+func warn(results kaffine.FunctionResults) {
+	var advisories []kaffine.Advisory
+	loaded := false
+	for _, r := range results {
+		if r.Action != "installed" && r.Action != "dependency" {
+			continue
+		}
+		for _, warning := range kaffine.LifecycleWarnings(kaffine.Fm.CatMan, r.Function, r.Version, false) {
+			fmt.Fprintln(kaffine.Stderr, warning)
+		}
+		if !loaded {
+			advisories = kaffine.Fm.Advisories(kaffine.Fm.CatMan)
+			loaded = true
+		}
+		kaffine.WarnAdvisories(kaffine.Stderr, r.Function, r.Version, kaffine.AffectedBy(advisories, r.Function, r.Version))
+	}
+}
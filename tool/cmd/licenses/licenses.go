@@ -0,0 +1,57 @@
+package licenses
+
+import (
+	"fmt"
+
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewLicensesCommand() *cobra.Command {
+	var deny bool
+
+	cmd := &cobra.Command{
+		Use:   "licenses",
+		Short: "Lists the licenses of the installed functions, grouped by license",
+		Long: `Lists the licenses of the installed functions, grouped by license and
+normalized to SPDX identifiers. Use -o csv or -o json to export the report.
+
+With --deny the command fails when a function has a copyleft, unknown or
+missing license. If policy.yaml lists allowedLicenses, it fails on any license
+not in that list instead.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report := kaffine.Fm.Licenses()
+			if err := kaffine.Print(cmd.OutOrStdout(), report); err != nil {
+				return err
+			}
+
+			denied := report.Denied()
+			if !deny || len(denied) == 0 {
+				return nil
+			}
+
+			for _, item := range denied {
+				license := item.License
+				if license == "" {
+					license = "<missing>"
+				}
+				fmt.Fprintf(kaffine.Stderr, "%s@%s: %s (%s)\n", item.Function, item.Version, license, item.Category)
+			}
+
+			reason := "copyleft, unknown or missing licenses"
+			if report.Policy != "" {
+				reason = fmt.Sprintf("licenses not allowed by %s", report.Policy)
+			}
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &kaffine.ExitError{Code: 1, Err: fmt.Errorf("%d function(s) have %s", len(denied), reason)}
+		},
+	}
+
+	cmd.Flags().BoolVar(&deny, "deny", false, "Exit with status 1 if any function has a copyleft or unlisted license")
+
+	return cmd
+}
@@ -1,8 +1,6 @@
 package list
 
 import (
-	"fmt"
-
 	"kaffine-mod/kaffine"
 
 	"github.com/spf13/cobra"
@@ -10,17 +8,11 @@ import (
 
 func NewListCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "list",
-		Short: "Lists the current installed catalog of functions",
+		Use:         "list",
+		Short:       "Lists the current installed catalog of functions",
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			b, err := kaffine.Fm.GenerateInstalledCatalog()
-			if err != nil {
-				return err
-			}
-
-			fmt.Println(string(b))
-
-			return nil
+			return kaffine.Print(cmd.OutOrStdout(), kaffine.Fm.ListFunctionDefinitions())
 		},
 	}
 
@@ -0,0 +1,52 @@
+package outdated
+
+import (
+	"fmt"
+
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewOutdatedCommand() *cobra.Command {
+	var offline, exitCode bool
+	var tags []string
+
+	cmd := &cobra.Command{
+		Use:         "outdated",
+		Short:       "Shows installed functions that have newer versions in the catalogs",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			catman := kaffine.Fm.CatMan
+			if !offline {
+				var errs map[string]error
+				catman, errs = kaffine.Fm.CatMan.FetchLatest(kaffine.Fm.CatMan.URIs)
+				for _, uri := range kaffine.Fm.CatMan.URIs {
+					if err, ok := errs[uri]; ok {
+						fmt.Fprintln(kaffine.Stderr, err)
+					}
+				}
+			}
+
+			report := kaffine.Fm.Outdated(catman).FilterTags(tags)
+			if err := kaffine.Print(cmd.OutOrStdout(), report); err != nil {
+				return err
+			}
+
+			if n := report.CountOutdated(); exitCode && n > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &kaffine.ExitError{Code: 1, Err: fmt.Errorf("%d function(s) are behind the version they could be updated to", n)}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&offline, "offline", false, "Use the cached catalogs instead of fetching them again")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with status 1 if any function can be updated")
+	cmd.Flags().StringSliceVar(&tags, "tag", nil, "Only report functions with one of these tags")
+
+	return cmd
+}
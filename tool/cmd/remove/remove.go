@@ -9,21 +9,37 @@ import (
 )
 
 func NewRemoveCommand() *cobra.Command {
+	var keepGoing bool
+	var force bool
+
 	cmd := &cobra.Command{
-		Use:   "remove [name]",
-		Short: "Searches the managed catalogs for a function with the specified name, and installs it",
+		Use:   "remove [name]...",
+		Short: "Removes the installed functions with the specified names",
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fname := args[len(args)-1]
-			krmFunc, err := kaffine.Fm.RemoveFunctionDefinition(fname)
-			if err != nil {
+			results, err := kaffine.Fm.RemoveFunctionDefinitions(args, keepGoing, force)
+			if err := kaffine.Print(cmd.OutOrStdout(), results); err != nil {
 				return err
 			}
+			if err == nil {
+				return nil
+			}
 
-			fmt.Println("Successfully removed KRM Function '" + krmFunc.GroupName() + "'")
+			for _, e := range results.Errors() {
+				fmt.Fprintln(kaffine.Stderr, e)
+			}
+			if !keepGoing {
+				err = fmt.Errorf("%v, nothing was removed", err)
+			}
 
-			return nil
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &kaffine.ExitError{Code: 1, Err: err, Save: keepGoing}
 		},
 	}
 
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Still remove the functions that can be removed when others fail")
+	cmd.Flags().BoolVar(&force, "force", false, "Remove the functions even when other installed functions depend on them")
+
 	return cmd
 }
@@ -0,0 +1,42 @@
+package rollback
+
+import (
+	"fmt"
+	"strconv"
+
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewRollbackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback [id]",
+		Short: "Restores installed functions, dependencies and catalogs to an entry of the history, by default the one before the current state",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			h, err := kaffine.Fm.History()
+			if err != nil {
+				return err
+			}
+
+			var id int
+			if len(args) == 1 {
+				if id, err = strconv.Atoi(args[0]); err != nil {
+					return fmt.Errorf("invalid history id '%s'", args[0])
+				}
+			} else if id, err = h.DefaultRollback(); err != nil {
+				return err
+			}
+
+			entry, err := kaffine.Fm.Rollback(id)
+			if err != nil {
+				return err
+			}
+
+			return kaffine.Print(cmd.OutOrStdout(), kaffine.History{Entries: []kaffine.HistoryEntry{entry}})
+		},
+	}
+
+	return cmd
+}
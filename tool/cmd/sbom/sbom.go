@@ -0,0 +1,44 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"kaffine-mod/kaffine"
+
+	"github.com/spf13/cobra"
+)
+
+func NewSBOMCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "sbom",
+		Short: "Writes an SBOM of the installed functions",
+		Long: `Writes a CycloneDX or SPDX software bill of materials of the installed
+functions. Each function lists its version, publisher, license, home page,
+container image and exec binaries, and the catalog it came from. The SBOM is
+always JSON, whatever -o says.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sbom, err := kaffine.Fm.SBOM(format)
+			if err != nil {
+				return err
+			}
+
+			b, err := json.MarshalIndent(sbom, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(b))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "cyclonedx", "SBOM format, one of "+strings.Join(kaffine.SBOMFormats, "|"))
+
+	return cmd
+}
@@ -1,28 +1,39 @@
 package search
 
 import (
-	"fmt"
 	"kaffine-mod/kaffine"
 
 	"github.com/spf13/cobra"
 )
 
 func NewSearchCommand() *cobra.Command {
+	var q kaffine.SearchQuery
+
 	cmd := &cobra.Command{
-		Use:   "search [name]",
-		Short: "Searches the managed catalogs for a function with the specified name",
+		Use:         "search [name]",
+		Short:       "Searches the managed catalogs for functions matching the name and filters, most relevant first",
+		Annotations: map[string]string{kaffine.ReadOnlyCommand: "true"},
+		Args:        cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fname := args[len(args)-1]
-			res, err := kaffine.Fm.SearchFunctionDefintions(fname)
+			if len(args) > 0 {
+				q.Name = args[0]
+			}
+			res, err := kaffine.Fm.SearchFunctionDefintions(q)
 			if err != nil {
 				return err
 			}
 
-			fmt.Println(string(res))
-
-			return nil
+			return kaffine.Print(cmd.OutOrStdout(), res)
 		},
 	}
 
+	cmd.Flags().StringSliceVar(&q.Tags, "tag", nil, "Only functions with all of these tags")
+	cmd.Flags().StringVar(&q.Publisher, "publisher", "", "Only functions whose publisher contains this")
+	cmd.Flags().StringVar(&q.License, "license", "", "Only versions with this license")
+	cmd.Flags().StringVar(&q.Runtime, "runtime", "", "Only versions with this runtime, exec or container")
+	cmd.Flags().StringVar(&q.Text, "text", "", "Words to look for in the name, description, tags and usage")
+	cmd.Flags().StringVar(&q.Os, "os", "", "Only versions with an exec runtime for this operating system")
+	cmd.Flags().StringVar(&q.Arch, "arch", "", "Only versions with an exec runtime for this architecture")
+
 	return cmd
 }
@@ -1,38 +1,74 @@
 package update
 
 import (
+	"errors"
 	"fmt"
 	"kaffine-mod/kaffine"
-	"os"
 
 	"github.com/spf13/cobra"
 )
 
 func NewUpdateCommand() *cobra.Command {
+	var dryRun, yes bool
+	var opts kaffine.UpdateOptions
+
 	cmd := &cobra.Command{
-		Use:   "update",
-		Short: "Updates all functions to their latest versions",
+		Use:   "update [names...]",
+		Short: "Updates functions to their latest versions, all of them if no names are given",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, errs := kaffine.Fm.CatMan.UpdateAllCatalogs()
-			for _, err := range errs {
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "%v\n", err)
+			opts.Functions = args
+			plan, err := kaffine.Fm.PlanUpdate(opts)
+			if err != nil {
+				return err
+			}
+			plan.DryRun = dryRun
+
+			if err := kaffine.Print(cmd.OutOrStdout(), plan); err != nil {
+				return err
+			}
+			for _, change := range plan.Functions {
+				for _, warning := range change.Warnings {
+					fmt.Fprintln(kaffine.Stderr, warning)
 				}
+				kaffine.WarnAdvisories(kaffine.Stderr, change.Function, change.To, change.Advisories)
+			}
+			if dryRun {
+				return nil
+			}
+			if err := plan.Err(); err != nil {
+				return err
 			}
+			if !plan.HasChanges() {
+				return nil
+			}
+
+			if plan.HasMajorUpgrades() && !yes {
+				if !kaffine.Interactive() {
+					return errors.New("the update includes major version upgrades, re-run with --yes to apply it")
+				}
 
-			_, errs = kaffine.Fm.UpdateAllFunctionDefinitions()
-			for _, err := range errs {
+				ok, err := kaffine.Confirm("The update includes major version upgrades. Apply it?")
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "%v\n", err)
-					// return err
+					return err
+				}
+				if !ok {
+					return errors.New("update cancelled")
 				}
 			}
 
-			fmt.Println("Successfully updated catalogs and functions")
+			if err := kaffine.Fm.ApplyPlan(plan); err != nil {
+				return err
+			}
+			fmt.Fprintln(kaffine.Stderr, "Update applied")
 
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print what would change")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply major version upgrades without asking")
+	cmd.Flags().StringSliceVar(&opts.Catalogs, "catalog", nil, "Only fetch these catalogs again")
+	cmd.Flags().StringVar(&opts.To, "to", "", "Move a single function to this version or constraint, even if it is pinned")
+
 	return cmd
 }
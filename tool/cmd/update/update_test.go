@@ -0,0 +1,141 @@
+package update
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kaffine-mod/kaffine"
+)
+
+const catalog = `apiVersion: config.kubernetes.io/v1alpha1
+kind: Catalog
+spec:
+  krmFunctions:
+  - group: example.com
+    names:
+      kind: Logger
+    versions:
+    - name: v1.0.0
+      runtime:
+        container:
+          image: logger:v1.0.0
+`
+
+// A workspace with example.com/Logger v1.0.0 installed from a catalog that
+// now has v2.0.0
+func setupWorkspace(t *testing.T) string {
+	kaffine.Stdin = strings.NewReader("")
+	kaffine.Stderr = io.Discard
+	t.Cleanup(func() {
+		kaffine.Stdin = os.Stdin
+		kaffine.Stderr = os.Stderr
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	os.WriteFile(path, []byte(catalog), 0644)
+	os.Mkdir(filepath.Join(dir, ".kaffine"), os.ModePerm)
+
+	fm, err := kaffine.NewFunctionManager(filepath.Join(dir, ".kaffine"), kaffine.ExclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	if err = fm.CatMan.AddCatalog("file://" + path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fm.AddFunctionDefinitions([]string{"example.com/Logger"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = fm.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path, []byte(strings.ReplaceAll(catalog, "v1.0.0", "v2.0.0")), 0644)
+
+	return dir
+}
+
+// Runs `kaffine update args...` in dir, saving only if it succeeds
+func runUpdate(t *testing.T, dir string, args ...string) error {
+	fm, err := kaffine.NewFunctionManager(filepath.Join(dir, ".kaffine"), kaffine.ExclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kaffine.Fm = fm
+	t.Cleanup(func() { kaffine.Fm = nil })
+
+	cmd := NewUpdateCommand()
+	cmd.SetArgs(args)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	if err := cmd.Execute(); err != nil {
+		fm.Close()
+		return err
+	}
+
+	return kaffine.DestroyGlobals()
+}
+
+// Every file under dir with its contents
+func snapshot(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		files[path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func installedVersion(t *testing.T, dir string) string {
+	fm, err := kaffine.NewFunctionManager(filepath.Join(dir, ".kaffine"), kaffine.SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	return fm.Installed["example.com/Logger"].Versions[0].Name
+}
+
+func TestUpdateDryRun(t *testing.T) {
+	dir := setupWorkspace(t)
+	before := snapshot(t, dir)
+
+	if err := runUpdate(t, dir, "--dry-run", "--yes"); err != nil {
+		t.Fatal(err)
+	}
+	if after := snapshot(t, dir); !reflect.DeepEqual(before, after) {
+		t.Error("--dry-run changed the workspace")
+	}
+}
+
+func TestUpdateMajorNeedsYes(t *testing.T) {
+	dir := setupWorkspace(t)
+
+	if err := runUpdate(t, dir); err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Errorf("expected the major upgrade to be refused, got %v", err)
+	}
+	if version := installedVersion(t, dir); version != "v1.0.0" {
+		t.Errorf("refused update installed %s", version)
+	}
+
+	if err := runUpdate(t, dir, "--yes"); err != nil {
+		t.Fatal(err)
+	}
+	if version := installedVersion(t, dir); version != "v2.0.0" {
+		t.Errorf("expected v2.0.0 after --yes, got %s", version)
+	}
+}
@@ -1,19 +1,18 @@
 package version
 
 import (
-	"fmt"
+	"kaffine-mod/kaffine"
 
 	"github.com/spf13/cobra"
 )
 
 func NewVersionCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "version",
-		Short: "Print the version number of Kaffine",
+		Use:         "version",
+		Short:       "Print the version number of Kaffine",
+		Annotations: map[string]string{kaffine.StandaloneCommand: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("Kaffine version 0.0.0")
-
-			return nil
+			return kaffine.Print(cmd.OutOrStdout(), kaffine.VersionResult{Version: kaffine.Version})
 		},
 	}
 
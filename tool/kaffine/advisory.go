@@ -0,0 +1,236 @@
+package kaffine
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// A known problem with some versions of a function, published in a catalog
+// or an advisory feed
+type Advisory struct {
+	ID string `json:"id"`
+	// group/Kind
+	Function string `json:"function"`
+	// Affected versions, as a single version or a constraint like
+	// ">=1.0.0 <1.0.2". Without it, every version before FixedIn.
+	Versions    string `json:"versions,omitempty"`
+	Severity    string `json:"severity"`
+	Description string `json:"description,omitempty"`
+	FixedIn     string `json:"fixedIn,omitempty"`
+	URL         string `json:"url,omitempty"`
+	// Catalog or feed the advisory came from
+	Source string `json:"source,omitempty"`
+}
+
+// Least to most severe
+var AdvisorySeverities = []string{"low", "medium", "high", "critical"}
+
+// A document with only advisories, listed under advisories in the config
+type AdvisoryFeed struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Advisories []Advisory `json:"advisories"`
+	} `json:"spec"`
+}
+
+// Severities that are not known rank above critical. Validate rejects them,
+// so they only come up for flags.
+func SeverityRank(severity string) int {
+	for i, s := range AdvisorySeverities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+
+	return len(AdvisorySeverities)
+}
+
+func (a Advisory) Validate() error {
+	if a.ID == "" {
+		return fmt.Errorf("advisory for '%s' has no id", a.Function)
+	}
+	if a.Function == "" {
+		return fmt.Errorf("advisory '%s' has no function", a.ID)
+	}
+	if a.Versions == "" && a.FixedIn == "" {
+		return fmt.Errorf("advisory '%s' has neither versions nor fixedIn", a.ID)
+	}
+	if SeverityRank(a.Severity) == len(AdvisorySeverities) {
+		return fmt.Errorf("advisory '%s' has unknown severity '%s' (expected one of %s)", a.ID, a.Severity, strings.Join(AdvisorySeverities, "|"))
+	}
+	if IsConstraint(a.Versions) {
+		if _, err := ParseConstraint(a.Versions); err != nil {
+			return fmt.Errorf("advisory '%s': %v", a.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (a Advisory) Affects(groupName string, version string) bool {
+	if !strings.EqualFold(a.Function, groupName) {
+		return false
+	}
+	if a.Versions == "" {
+		return CompareVersions(version, a.FixedIn) < 0
+	}
+
+	return MatchesVersion(version, a.Versions)
+}
+
+// The advisories in the catalogs of cm, in catalog order, followed by the
+// ones from the configured feeds. Feeds are not cached but fetched the first
+// time they are needed, so a new advisory takes effect right away. Feeds that
+// cannot be fetched and invalid advisories are reported and skipped.
+func (fm *FunctionManager) Advisories(cm *CatalogManager) (advisories []Advisory) {
+	cm.Load()
+	add := func(source string, as []Advisory) {
+		for _, a := range as {
+			if err := a.Validate(); err != nil {
+				fmt.Fprintf(Stderr, "warning: %s: %v\n", source, err)
+				continue
+			}
+			a.Source = source
+			advisories = append(advisories, a)
+		}
+	}
+
+	for _, uri := range cm.URIs {
+		add(uri, cm.Catalogs[uri].Spec.Advisories)
+	}
+
+	if fm.feedAdvisories == nil {
+		fm.feedAdvisories = map[string][]Advisory{}
+		for _, uri := range fm.Cfg.Advisories {
+			feed, err := fm.CatMan.GetAdvisoryFeed(uri)
+			if err != nil {
+				fmt.Fprintf(Stderr, "warning: could not fetch advisory feed '%s': %v\n", uri, err)
+				continue
+			}
+			fm.feedAdvisories[uri] = feed.Spec.Advisories
+		}
+	}
+	for _, uri := range fm.Cfg.Advisories {
+		add(uri, fm.feedAdvisories[uri])
+	}
+
+	return
+}
+
+// Fetches a feed like a catalog, so it can be signed and go through a proxy
+// the same way
+func (cm *CatalogManager) GetAdvisoryFeed(uri string) (feed AdvisoryFeed, err error) {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return
+	}
+
+	data, err := cm.fetchCatalogData(uri, u)
+	if err != nil {
+		return
+	}
+	if err = cm.verifyCatalog(uri, data); err != nil {
+		return
+	}
+
+	err = yaml.Unmarshal(data, &feed)
+	return
+}
+
+// The advisories affecting one version of a function, most severe first
+func AffectedBy(advisories []Advisory, groupName string, version string) (affected []Advisory) {
+	for _, a := range advisories {
+		if a.Affects(groupName, version) {
+			affected = append(affected, a)
+		}
+	}
+	sortAdvisories(affected)
+
+	return
+}
+
+func sortAdvisories(advisories []Advisory) {
+	sort.SliceStable(advisories, func(i, j int) bool {
+		return SeverityRank(advisories[i].Severity) > SeverityRank(advisories[j].Severity)
+	})
+}
+
+// Tells the user they are about to use an affected version
+func WarnAdvisories(w io.Writer, groupName string, version string, advisories []Advisory) {
+	for _, a := range advisories {
+		msg := fmt.Sprintf("warning: %s@%s is affected by %s (%s)", groupName, version, a.ID, a.Severity)
+		if a.Description != "" {
+			msg += ": " + a.Description
+		}
+		if a.FixedIn != "" {
+			msg += fmt.Sprintf(", fixed in %s", a.FixedIn)
+		}
+		fmt.Fprintln(w, msg)
+	}
+}
+
+type AuditFinding struct {
+	Function string `json:"function"`
+	Version  string `json:"version"`
+	Advisory
+}
+
+type AuditReport struct {
+	Findings []AuditFinding `json:"findings"`
+}
+
+// Matches every installed function against the advisories in cm and the
+// feeds, most severe first
+func (fm *FunctionManager) Audit(cm *CatalogManager) (report AuditReport) {
+	advisories := fm.Advisories(cm)
+
+	report.Findings = []AuditFinding{}
+	for _, groupName := range fm.InstalledNames() {
+		fd := fm.Installed[groupName]
+		if len(fd.Versions) == 0 {
+			continue
+		}
+		version := fd.Versions[0].Name
+		for _, a := range advisories {
+			if a.Affects(groupName, version) {
+				report.Findings = append(report.Findings, AuditFinding{Function: groupName, Version: version, Advisory: a})
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return SeverityRank(report.Findings[i].Severity) > SeverityRank(report.Findings[j].Severity)
+	})
+
+	return
+}
+
+// Only keeps findings at least as severe as severity
+func (report AuditReport) FilterSeverity(severity string) (filtered AuditReport) {
+	filtered.Findings = []AuditFinding{}
+	for _, f := range report.Findings {
+		if SeverityRank(f.Severity) >= SeverityRank(severity) {
+			filtered.Findings = append(filtered.Findings, f)
+		}
+	}
+
+	return
+}
+
+func (report AuditReport) Header() []string {
+	return []string{"FUNCTION", "VERSION", "ADVISORY", "SEVERITY", "FIXED IN", "DESCRIPTION"}
+}
+
+func (report AuditReport) Rows() (rows [][]string) {
+	for _, f := range report.Findings {
+		rows = append(rows, []string{f.Function, f.Version, f.ID, f.Severity, orNone(f.FixedIn), f.Description})
+	}
+
+	return
+}
@@ -0,0 +1,71 @@
+package kaffine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdvisoryAffects(t *testing.T) {
+	var tests = []struct {
+		advisory Advisory
+		fn       string
+		version  string
+		affected bool
+	}{
+		{Advisory{Function: "example.com/Logger", Versions: "v1.0.1"}, "example.com/Logger", "v1.0.1", true},
+		{Advisory{Function: "example.com/Logger", Versions: "v1.0.1"}, "example.com/Logger", "v1.0.2", false},
+		{Advisory{Function: "example.com/Logger", Versions: ">=1.0.0 <1.0.2"}, "example.com/Logger", "v1.0.1", true},
+		{Advisory{Function: "example.com/Logger", Versions: ">=1.0.0 <1.0.2"}, "example.com/Logger", "v1.0.2", false},
+		{Advisory{Function: "example.com/Logger", Versions: "^1 || 2.0.0"}, "example.com/Logger", "v2.0.0", true},
+		{Advisory{Function: "example.com/Logger", FixedIn: "v1.0.2"}, "example.com/Logger", "v1.0.1", true},
+		{Advisory{Function: "example.com/Logger", FixedIn: "v1.0.2"}, "example.com/Logger", "v1.0.2", false},
+		{Advisory{Function: "example.com/Logger", FixedIn: "v1.0.2"}, "example.com/logger", "v1.0.0", true},
+		{Advisory{Function: "example.com/Logger", FixedIn: "v1.0.2"}, "other.com/Logger", "v1.0.0", false},
+	}
+
+	for _, test := range tests {
+		if affected := test.advisory.Affects(test.fn, test.version); affected != test.affected {
+			t.Errorf("%+v.Affects(%q, %q) = %v, want %v", test.advisory, test.fn, test.version, affected, test.affected)
+		}
+	}
+}
+
+func TestAdvisoryValidate(t *testing.T) {
+	var tests = []struct {
+		advisory Advisory
+		valid    bool
+	}{
+		{Advisory{ID: "A-1", Function: "example.com/Logger", Versions: "<1.0.2", Severity: "high"}, true},
+		{Advisory{ID: "A-1", Function: "example.com/Logger", FixedIn: "v1.0.2", Severity: "Critical"}, true},
+		{Advisory{Function: "example.com/Logger", FixedIn: "v1.0.2", Severity: "high"}, false},
+		{Advisory{ID: "A-1", FixedIn: "v1.0.2", Severity: "high"}, false},
+		{Advisory{ID: "A-1", Function: "example.com/Logger", Severity: "high"}, false},
+		{Advisory{ID: "A-1", Function: "example.com/Logger", Versions: ">=banana", Severity: "high"}, false},
+		{Advisory{ID: "A-1", Function: "example.com/Logger", FixedIn: "v1.0.2", Severity: "hgih"}, false},
+		{Advisory{ID: "A-1", Function: "example.com/Logger", FixedIn: "v1.0.2"}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.advisory.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v.Validate() = %v, want valid %v", test.advisory, err, test.valid)
+		}
+	}
+}
+
+func TestAffectedBySeverity(t *testing.T) {
+	advisories := []Advisory{
+		{ID: "low", Function: "example.com/Logger", FixedIn: "v2", Severity: "low"},
+		{ID: "other", Function: "example.com/Other", FixedIn: "v2", Severity: "critical"},
+		{ID: "critical", Function: "example.com/Logger", FixedIn: "v2", Severity: "critical"},
+		{ID: "medium", Function: "example.com/Logger", FixedIn: "v2", Severity: "Medium"},
+	}
+
+	affected := AffectedBy(advisories, "example.com/Logger", "v1")
+	var ids []string
+	for _, a := range affected {
+		ids = append(ids, a.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"critical", "medium", "low"}) {
+		t.Errorf("expected critical, medium, low, got %v", ids)
+	}
+}
@@ -3,13 +3,14 @@ package kaffine
 import (
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 
+	"golang.org/x/exp/maps"
 	"sigs.k8s.io/yaml"
 )
 
@@ -17,6 +18,39 @@ type CatalogManager struct {
 	Directory string
 	Catalogs  map[string]FunctionCatalog
 	Functions map[string]FunctionDefinition
+	// Catalog uris in the order they were added
+	URIs []string
+	// Kept in step with the catalogs by AddCatalog, RemoveCatalog and
+	// swapCatalogs
+	Index *SearchIndex
+	Fetch FetchOptions
+	HTTP  *HTTPClient
+	// From the config, by uri
+	Options map[string]CatalogOptions
+	// Every catalog needs a valid signature, not just ones with keys
+	RequireSignatures bool
+	AllowUnsigned     bool
+
+	dirty bool
+	// Catalogs are only parsed by Load, the first time they are needed, or
+	// one by one for lookups the index can narrow down
+	loaded bool
+	parsed map[string]FunctionCatalog
+	// Read once, by Load or the first lookup before it
+	indexLoaded bool
+	// The catalog of each function according to the index, before Load
+	indexSources map[string]string
+	// As loaded from the cache, to record in the history
+	loadedCatalogs map[string]FunctionCatalog
+	loadedURIs     []string
+	// Configured catalogs that could not be loaded, which stay in the config
+	// so a failed fetch does not drop them
+	failed map[string]bool
+	// In the order of the config
+	configuredURIs []string
+	// Signing fingerprint each catalog was verified with, by uri, so the
+	// cache only vouches for catalogs checked against the current keys
+	verified *sync.Map
 }
 
 func MakeCatalogManager(directory string) CatalogManager {
@@ -24,34 +58,193 @@ func MakeCatalogManager(directory string) CatalogManager {
 	cm.Directory = filepath.Clean(filepath.Join(directory, "/catalogs"))
 	cm.Catalogs = map[string]FunctionCatalog{}
 	cm.Functions = map[string]FunctionDefinition{}
+	cm.verified = &sync.Map{}
+	cm.Index = &SearchIndex{FilePath: filepath.Join(directory, "search-index.json"), Catalogs: map[string]IndexedCatalog{}}
+	cm.Fetch = DefaultFetchOptions
+	cm.HTTP, _ = NewHTTPClient(DefaultHTTPOptions, cm.Fetch)
 
 	os.MkdirAll(cm.Directory, os.ModePerm)
 
 	return cm
 }
 
-func (cm *CatalogManager) Save() (err error) {
-	os.RemoveAll(cm.Directory)
-	os.MkdirAll(cm.Directory, os.ModePerm)
-
+// Cached catalogs, by file name
+func (cm *CatalogManager) files() (map[string][]byte, error) {
+	files := map[string][]byte{}
 	for uri, cat := range cm.Catalogs {
 		b, err := yaml.Marshal(cat)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		hashName := SHA1(uri) + ".yaml"
-		err = os.WriteFile(filepath.Join(cm.Directory, hashName), b, os.ModePerm)
-		if err != nil {
-			return err
+		files[SHA1(uri)+".yaml"] = b
+		if fingerprint := cm.verifiedWith(uri); fingerprint != "" {
+			files[SHA1(uri)+verifiedSuffix] = []byte(fingerprint + "\n")
 		}
 	}
 
-	return
+	return files, nil
+}
+
+// Parses the catalogs in URIs, fetching the ones that are not cached, along
+// with the search index. Catalogs that cannot be loaded are reported and
+// dropped. Only the first call does anything.
+func (cm *CatalogManager) Load() {
+	if cm.loaded {
+		return
+	}
+	cm.loaded = true
+
+	cm.loadIndex()
+
+	// Catalogs missing from the cache are fetched all at once, then
+	// everything is added in the configured order
+	uris := cm.URIs
+	cm.URIs = nil
+	cm.configuredURIs = uris
+	cm.failed = map[string]bool{}
+	cats := make([]FunctionCatalog, len(uris))
+	errs := make([]error, len(uris))
+	cached := make([]bool, len(uris))
+	var missing []string
+	var missingIdx []int
+	for i, uri := range uris {
+		if cats[i], errs[i] = cm.GetCachedCatalog(uri); errs[i] != nil {
+			missing = append(missing, uri)
+			missingIdx = append(missingIdx, i)
+		} else {
+			cached[i] = true
+		}
+	}
+	fetched, fetchErrs := cm.fetchAll(missing)
+	for j, i := range missingIdx {
+		cats[i], errs[i] = fetched[j], fetchErrs[j]
+	}
+
+	for i, uri := range uris {
+		if errs[i] == nil {
+			errs[i] = cm.addCatalog(uri, cats[i], cached[i])
+		}
+		if errs[i] != nil {
+			fmt.Fprintln(Stderr, errs[i])
+			cm.failed[uri] = true
+		}
+	}
+	cm.Index.Retain(cm.URIs)
+	cm.loadedCatalogs = maps.Clone(cm.Catalogs)
+	cm.loadedURIs = append([]string{}, cm.URIs...)
+}
+
+// The catalogs to keep in the config: the loaded ones, with the configured
+// ones that could not be loaded kept where they were
+func (cm *CatalogManager) ConfiguredURIs() []string {
+	uris := []string{}
+	loaded := map[string]bool{}
+	for _, uri := range cm.URIs {
+		loaded[uri] = true
+	}
+	seen := map[string]bool{}
+	for _, uri := range cm.configuredURIs {
+		if (cm.failed[uri] || loaded[uri]) && !seen[uri] {
+			uris = append(uris, uri)
+			seen[uri] = true
+		}
+	}
+	for _, uri := range cm.URIs {
+		if !seen[uri] {
+			uris = append(uris, uri)
+		}
+	}
+
+	return uris
+}
+
+func (cm *CatalogManager) loadIndex() {
+	if cm.indexLoaded {
+		return
+	}
+	cm.indexLoaded = true
+
+	index := MakeSearchIndex(cm.Index.FilePath)
+	cm.Index = &index
+}
+
+// The catalog each function is in according to the index, or false when the
+// index is missing one of the catalogs
+func (cm *CatalogManager) indexedSources() (map[string]string, bool) {
+	if cm.indexSources != nil {
+		return cm.indexSources, true
+	}
+
+	cm.loadIndex()
+	sources := map[string]string{}
+	for _, uri := range cm.URIs {
+		ic, ok := cm.Index.Catalogs[uri]
+		if !ok {
+			return nil, false
+		}
+		for _, groupName := range ic.functions {
+			if _, ok := sources[groupName]; !ok {
+				sources[groupName] = uri
+			}
+		}
+	}
+	cm.indexSources = sources
+
+	return sources, true
+}
+
+// The definition of groupName in its catalog. Before Load only that catalog
+// is parsed, when the index knows which one it is.
+func (cm *CatalogManager) Function(groupName string) (FunctionDefinition, bool) {
+	if !cm.loaded {
+		if sources, ok := cm.indexedSources(); ok {
+			uri, found := sources[groupName]
+			if !found {
+				return FunctionDefinition{}, false
+			}
+			if fc, err := cm.parseCatalog(uri); err == nil {
+				for _, fn := range fc.Spec.KrmFunctions {
+					if fn.GroupName() == groupName {
+						return fn, true
+					}
+				}
+			}
+		}
+	}
+
+	cm.Load()
+	fn, ok := cm.Functions[groupName]
+
+	return fn, ok
+}
+
+// Reads a single catalog from the cache, once
+func (cm *CatalogManager) parseCatalog(uri string) (FunctionCatalog, error) {
+	if fc, ok := cm.parsed[uri]; ok {
+		return fc, nil
+	}
+
+	fc, err := cm.GetCachedCatalog(uri)
+	if err != nil {
+		return fc, err
+	}
+	if cm.parsed == nil {
+		cm.parsed = map[string]FunctionCatalog{}
+	}
+	cm.parsed[uri] = fc
+
+	return fc, nil
+}
+
+func (cm *CatalogManager) Loaded() bool {
+	return cm.loaded
 }
 
 // Tries to look in cache first
 func (cm *CatalogManager) AddCatalog(uri string) (err error) {
+	cm.Load()
+
 	// Already added
 	if _, ok := cm.Catalogs[uri]; ok {
 		return errors.New("catalog already present")
@@ -60,6 +253,7 @@ func (cm *CatalogManager) AddCatalog(uri string) (err error) {
 	// Cached on the filesystem
 	cat := FunctionCatalog{}
 
+	cached := true
 	cat, err = cm.GetCachedCatalog(uri)
 	if err != nil {
 		cat, err = cm.GetExternalCatalog(uri)
@@ -68,8 +262,34 @@ func (cm *CatalogManager) AddCatalog(uri string) (err error) {
 		if err != nil {
 			return err
 		}
+		cached = false
 	}
 
+	return cm.addCatalog(uri, cat, cached)
+}
+
+// Adds a catalog that was read from the cache or fetched
+func (cm *CatalogManager) addCatalog(uri string, cat FunctionCatalog, cached bool) error {
+	if _, ok := cm.Catalogs[uri]; ok {
+		return errors.New("catalog already present")
+	}
+
+	if err := cm.insertCatalog(uri, cat); err != nil {
+		return err
+	}
+	delete(cm.failed, uri)
+	if !cached {
+		cm.dirty = true
+	}
+	if !cached || !cm.Index.Has(uri) {
+		cm.Index.Add(uri, cat)
+	}
+
+	return nil
+}
+
+// Adds an already loaded catalog after the others
+func (cm *CatalogManager) insertCatalog(uri string, cat FunctionCatalog) error {
 	// Check for conflicting names
 	for _, fn := range cat.Spec.KrmFunctions {
 		if _, ok := cm.Functions[fn.GroupName()]; ok {
@@ -84,10 +304,67 @@ func (cm *CatalogManager) AddCatalog(uri string) (err error) {
 		cm.Functions[fn.GroupName()] = fn
 	}
 	cm.Catalogs[uri] = cat
+	cm.URIs = append(cm.URIs, uri)
 
 	return nil
 }
 
+// Fetches the catalogs with the given uris again into a separate
+// CatalogManager, leaving this one untouched. Catalogs that are not fetched or
+// cannot be fetched keep their current contents, and errors are returned by
+// uri.
+func (cm *CatalogManager) FetchLatest(uris []string) (latest *CatalogManager, errs map[string]error) {
+	cm.Load()
+	latest = &CatalogManager{
+		Directory: cm.Directory,
+		Catalogs:  map[string]FunctionCatalog{},
+		Functions: map[string]FunctionDefinition{},
+		loaded:    true,
+	}
+	errs = map[string]error{}
+
+	fetch := map[string]bool{}
+	for _, uri := range uris {
+		fetch[uri] = true
+	}
+
+	// Fetched concurrently, but merged in the order the catalogs were added
+	// so that which one wins a conflict does not depend on timing
+	var fetchURIs []string
+	for _, uri := range cm.URIs {
+		if fetch[uri] {
+			fetchURIs = append(fetchURIs, uri)
+		}
+	}
+	fcs, fetchErrs := cm.fetchAll(fetchURIs)
+	fetched := map[string]FunctionCatalog{}
+	for i, uri := range fetchURIs {
+		if fetchErrs[i] != nil {
+			errs[uri] = fmt.Errorf("could not fetch catalog '%s': %v", uri, fetchErrs[i])
+			fcs[i] = cm.Catalogs[uri]
+		}
+		fetched[uri] = fcs[i]
+	}
+
+	for _, uri := range cm.URIs {
+		if !fetch[uri] {
+			// A catalog fetched before it can now claim one of its names
+			if err := latest.insertCatalog(uri, cm.Catalogs[uri]); err != nil {
+				errs[uri] = fmt.Errorf("catalog '%s': %v", uri, err)
+			}
+			continue
+		}
+
+		fc := fetched[uri]
+		if err := latest.insertCatalog(uri, fc); err != nil {
+			errs[uri] = fmt.Errorf("catalog '%s': %v", uri, err)
+			latest.insertCatalog(uri, cm.Catalogs[uri])
+		}
+	}
+
+	return latest, errs
+}
+
 func (cm *CatalogManager) GetCachedCatalog(uri string) (fc FunctionCatalog, err error) {
 	catalogFileInfo, err := os.ReadDir(cm.Directory)
 	if err != nil {
@@ -117,6 +394,16 @@ func (cm *CatalogManager) GetCachedCatalog(uri string) (fc FunctionCatalog, err
 		return
 	}
 
+	// Signing options added or changed since the catalog was cached mean it
+	// has to be fetched and verified again
+	if fingerprint := cm.signingFingerprint(uri); fingerprint != "" {
+		verified, _ := os.ReadFile(filepath.Join(cm.Directory, SHA1(uri)+verifiedSuffix))
+		if strings.TrimSpace(string(verified)) != fingerprint {
+			return fc, fmt.Errorf("cached catalog '%s' was not verified with its current public keys", uri)
+		}
+		cm.setVerified(uri, fingerprint)
+	}
+
 	return
 }
 
@@ -126,23 +413,13 @@ func (cm *CatalogManager) GetExternalCatalog(uri string) (fc FunctionCatalog, er
 		return
 	}
 
-	var data []byte
-
-	if u.Scheme == "file" {
-		data, err = os.ReadFile(u.Path)
-	} else {
-		var resp *http.Response
-		resp, err = http.Get(uri)
-		if err != nil {
-			return
-		}
-		defer resp.Body.Close()
-		data, err = io.ReadAll(resp.Body)
-	}
-
+	data, err := cm.fetchCatalogData(uri, u)
 	if err != nil {
 		return
 	}
+	if err = cm.verifyCatalog(uri, data); err != nil {
+		return
+	}
 
 	err = yaml.Unmarshal(data, &fc)
 	if err != nil {
@@ -154,6 +431,11 @@ func (cm *CatalogManager) GetExternalCatalog(uri string) (fc FunctionCatalog, er
 
 // Removes all traces
 func (cm *CatalogManager) RemoveCatalog(uri string) (oldFc FunctionCatalog, err error) {
+	cm.Load()
+	if cm.failed[uri] {
+		delete(cm.failed, uri)
+		return oldFc, nil
+	}
 	if _, ok := cm.Catalogs[uri]; !ok {
 		return oldFc, errors.New("catalog with uri not present")
 	}
@@ -165,103 +447,153 @@ func (cm *CatalogManager) RemoveCatalog(uri string) (oldFc FunctionCatalog, err
 	oldFc = cm.Catalogs[uri]
 
 	delete(cm.Catalogs, uri)
+	for i, x := range cm.URIs {
+		if x == uri {
+			cm.URIs = append(cm.URIs[:i], cm.URIs[i+1:]...)
+			break
+		}
+	}
+	cm.Index.Remove(uri)
+	cm.dirty = true
 
 	return oldFc, nil
 }
 
-// Clobbers catalog
+// Clobbers catalog. If the fetch or the conflict check fails the old catalog
+// stays in place.
 func (cm *CatalogManager) UpdateCatalog(uri string) (oldFc FunctionCatalog, err error) {
-	// fmt.Println("UPDATING", uri)
-	// fmt.Println("REMOVING", uri)
-	oldFc, err = cm.RemoveCatalog(uri)
-	if err != nil {
-		return
+	cm.Load()
+	if _, ok := cm.Catalogs[uri]; !ok {
+		return oldFc, errors.New("catalog with uri not present")
 	}
 
-	// fmt.Println("GETTING EXTERNAL", uri)
-	var newFc FunctionCatalog
-	newFc, err = cm.GetExternalCatalog(uri)
-	if err != nil {
-		// cm.Catalogs[uri] = oldFc
-		return
-	}
+	return cm.Catalogs[uri], cm.replaceCatalogs([]string{uri})
+}
 
-	// fmt.Println("PUTTING INTO MEMORY")
+// Either every catalog is updated, or none are
+func (cm *CatalogManager) UpdateAllCatalogs() (oldFcs []FunctionCatalog, err error) {
+	cm.Load()
+	for _, uri := range cm.URIs {
+		oldFcs = append(oldFcs, cm.Catalogs[uri])
+	}
 
-	// Check for conflicting names
-	for _, fn := range newFc.Spec.KrmFunctions {
-		if _, ok := cm.Functions[fn.GroupName()]; ok {
-			return oldFc, errors.New("attempted to add catalog that contains conflicting names")
-		}
-		if len(fn.Versions) == 0 {
-			return oldFc, fmt.Errorf("attempted to add function '%s' with no versions", fn.GroupName())
-		}
+	if err = cm.replaceCatalogs(cm.URIs); err != nil {
+		return nil, err
 	}
 
-	for _, fn := range newFc.Spec.KrmFunctions {
-		cm.Functions[fn.GroupName()] = fn
+	return oldFcs, nil
+}
+
+// Fetches the catalogs and swaps them in only if all of them succeed
+func (cm *CatalogManager) replaceCatalogs(uris []string) error {
+	latest, errs := cm.FetchLatest(uris)
+	for _, uri := range cm.URIs {
+		if err, ok := errs[uri]; ok {
+			return err
+		}
 	}
-	cm.Catalogs[uri] = newFc
 
-	// b, _ := yaml.Marshal(newFc)
-	// for _, fn := range cm.Catalogs[uri].Spec.KrmFunctions {
-	// 	fmt.Println(fn)
-	// }
-	// fmt.Println(string(b))
+	cm.swapCatalogs(latest)
 
-	return
+	return nil
 }
 
-func (cm *CatalogManager) UpdateAllCatalogs() (oldFcs []FunctionCatalog, errs []error) {
-	for uri, _ := range cm.Catalogs {
-		fc, err := cm.UpdateCatalog(uri)
-		oldFcs = append(oldFcs, fc)
-		errs = append(errs, err)
+// Takes over the catalogs of other, reindexing the ones that changed
+func (cm *CatalogManager) swapCatalogs(other *CatalogManager) {
+	cm.Load()
+	for _, uri := range other.URIs {
+		if !reflect.DeepEqual(cm.Catalogs[uri], other.Catalogs[uri]) {
+			cm.Index.Add(uri, other.Catalogs[uri])
+			cm.dirty = true
+		}
+	}
+	for _, uri := range cm.URIs {
+		if _, ok := other.Catalogs[uri]; !ok {
+			cm.Index.Remove(uri)
+			cm.dirty = true
+		}
 	}
 
-	return
+	cm.Catalogs = other.Catalogs
+	cm.Functions = other.Functions
+	cm.URIs = other.URIs
 }
 
 // use .GroupName() function
 func (cm *CatalogManager) Search(fname string, lowercase bool) (fns []FunctionDefinition, err error) {
-	// fmt.Println("SEARCHING FOR" + fname)
-	group, name, version := ToGroupNameVersion(fname)
-	groupName := name
-	if group != "" {
-		groupName = group + "/" + groupName
+	cm.Load()
+	for _, queryDef := range cm.Functions {
+		if match, ok := searchMatch(queryDef, fname, lowercase); ok {
+			fns = append(fns, match)
+		}
 	}
 
-	for _, queryDef := range cm.Functions {
-		// fmt.Println("CHECKING", queryDef.GroupName(), "AGAINST", groupName)
-		if lowercase {
-			if !strings.Contains(strings.ToLower(queryDef.GroupName()), strings.ToLower(groupName)) {
-				continue
+	SortFunctionDefinitions(fns)
+
+	return fns, nil
+}
+
+// Whether queryDef matches the search term, and if so queryDef with only the
+// versions the term asks for
+func searchMatch(queryDef FunctionDefinition, fname string, lowercase bool) (FunctionDefinition, bool) {
+	_, _, version := ToGroupNameVersion(fname)
+	if !matchesName(queryDef.GroupName(), fname, lowercase) {
+		return queryDef, false
+	}
+
+	if version != "" {
+		var versions []FunctionVersion
+		for _, queryVersion := range queryDef.Versions {
+			if MatchesVersion(queryVersion.Name, version) {
+				versions = append(versions, queryVersion)
 			}
-		} else if !strings.Contains(queryDef.GroupName(), groupName) {
-			continue
 		}
 
-		if version != "" {
-			var versions []FunctionVersion
-			for _, queryVersion := range queryDef.Versions {
-				if queryVersion.Name == version {
-					versions = append(versions, queryVersion)
-				}
-			}
+		if len(versions) == 0 {
+			return queryDef, false
+		}
 
-			if len(versions) == 0 {
-				continue
-			}
+		queryDef.Versions = versions
+	}
 
-			queryDef.Versions = versions
+	return queryDef, true
+}
+
+// Whether group/name contains the group/name of fname, ignoring its version
+func matchesName(groupName string, fname string, lowercase bool) bool {
+	group, name, _ := ToGroupNameVersion(fname)
+	if group != "" {
+		name = group + "/" + name
+	}
+
+	if lowercase {
+		return strings.Contains(strings.ToLower(groupName), strings.ToLower(name))
+	}
+
+	return strings.Contains(groupName, name)
+}
+
+// Uri of the catalog that provides the function, or "" if none does
+func (cm *CatalogManager) Source(groupName string) string {
+	if !cm.loaded {
+		if sources, ok := cm.indexedSources(); ok {
+			return sources[groupName]
+		}
+	}
+	cm.Load()
+	for _, uri := range cm.URIs {
+		for _, fn := range cm.Catalogs[uri].Spec.KrmFunctions {
+			if fn.GroupName() == groupName {
+				return uri
+			}
 		}
-		fns = append(fns, queryDef)
 	}
 
-	return fns, nil
+	return ""
 }
 
 func (cm *CatalogManager) SearchExact(fname string) (fn FunctionDefinition, err error) {
+	cm.Load()
 	group, name, version := ToGroupNameVersion(fname)
 	groupName := name
 	if group != "" {
@@ -277,7 +609,7 @@ func (cm *CatalogManager) SearchExact(fname string) (fn FunctionDefinition, err
 	if version != "" {
 		var versions []FunctionVersion
 		for _, queryVersion := range fn.Versions {
-			if queryVersion.Name == version {
+			if MatchesVersion(queryVersion.Name, version) {
 				versions = append(versions, queryVersion)
 			}
 		}
@@ -292,7 +624,27 @@ func (cm *CatalogManager) SearchExact(fname string) (fn FunctionDefinition, err
 	return
 }
 
-// INPUT MUST BE SORTED
+// Searches for several terms in a single pass over the functions. Results
+// and errors are in the same order as fnames.
 func (cm *CatalogManager) SearchMultiple(fnames []string) (fnss [][]FunctionDefinition, errs []error) {
+	cm.Load()
+	fnss = make([][]FunctionDefinition, len(fnames))
+	errs = make([]error, len(fnames))
+
+	for _, queryDef := range cm.Functions {
+		for i, fname := range fnames {
+			if match, ok := searchMatch(queryDef, fname, false); ok {
+				fnss[i] = append(fnss[i], match)
+			}
+		}
+	}
+
+	for i, fname := range fnames {
+		SortFunctionDefinitions(fnss[i])
+		if len(fnss[i]) == 0 {
+			errs[i] = fmt.Errorf("no functions with name '%s'", fname)
+		}
+	}
+
 	return
 }
@@ -0,0 +1,129 @@
+package kaffine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `apiVersion: config.kubernetes.io/v1alpha1
+kind: Catalog
+spec:
+  krmFunctions:
+  - group: example.com
+    names:
+      kind: Logger
+    versions:
+    - name: v1.0.0
+      runtime:
+        container:
+          image: logger:v1.0.0
+`
+
+func TestUpdateCatalogKeepsOldCatalogOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + catalogPath
+	os.WriteFile(catalogPath, []byte(testCatalog), 0644)
+
+	cm := MakeCatalogManager(dir)
+	if err := cm.AddCatalog(uri); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name, contents string
+	}{
+		{"unparseable", "spec: ["},
+		{"no versions", "spec:\n  krmFunctions:\n  - group: example.com\n    names:\n      kind: Logger\n"},
+	}
+
+	for _, test := range tests {
+		os.WriteFile(catalogPath, []byte(test.contents), 0644)
+
+		if _, err := cm.UpdateCatalog(uri); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+		if _, err := cm.UpdateAllCatalogs(); err == nil {
+			t.Errorf("%s: expected error from UpdateAllCatalogs", test.name)
+		}
+		if _, ok := cm.Catalogs[uri]; !ok || len(cm.URIs) != 1 {
+			t.Errorf("%s: catalog was removed", test.name)
+		}
+		if _, err := cm.SearchExact("example.com/Logger@v1.0.0"); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestSearchMultiple(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := filepath.Join(dir, "catalog.yaml")
+	os.WriteFile(catalogPath, []byte(testCatalog), 0644)
+
+	cm := MakeCatalogManager(dir)
+	if err := cm.AddCatalog("file://" + catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		fname   string
+		results int
+	}{
+		{"Logger", 1},
+		{"Nope", 0},
+		{"example.com/Logger@v1.0.0", 1},
+		{"Logger@v2.0.0", 0},
+	}
+
+	var fnames []string
+	for _, test := range tests {
+		fnames = append(fnames, test.fname)
+	}
+
+	fnss, errs := cm.SearchMultiple(fnames)
+	for i, test := range tests {
+		if len(fnss[i]) != test.results {
+			t.Errorf("%s: got %d results, want %d", test.fname, len(fnss[i]), test.results)
+		}
+		if (errs[i] == nil) != (test.results > 0) {
+			t.Errorf("%s: unexpected error %v", test.fname, errs[i])
+		}
+	}
+}
+
+func TestFailedCatalogStaysConfigured(t *testing.T) {
+	var stderr bytes.Buffer
+	Stderr = &stderr
+	t.Cleanup(func() { Stderr = os.Stderr })
+
+	dir := t.TempDir()
+	missing := "file://" + filepath.Join(dir, "missing.yaml")
+	path := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + path
+	writeHistoryCatalog(t, path, "v1.0.0")
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("catalogs:\n  - "+missing+"\n"), 0644)
+
+	runHistoryCommand(t, dir, "config add-catalog", func(fm *FunctionManager) error {
+		return fm.CatMan.AddCatalog(uri)
+	})
+	if !strings.HasSuffix(stderr.String(), "\n") {
+		t.Errorf("expected the load error on a line of its own, got %q", stderr.String())
+	}
+
+	c := MakeConfig(dir)
+	if want := []string{missing, uri}; !reflect.DeepEqual(c.Catalogs, want) {
+		t.Errorf("expected catalogs %v, got %v", want, c.Catalogs)
+	}
+
+	runHistoryCommand(t, dir, "config remove-catalog", func(fm *FunctionManager) error {
+		_, err := fm.CatMan.RemoveCatalog(missing)
+		return err
+	})
+	if c = MakeConfig(dir); !reflect.DeepEqual(c.Catalogs, []string{uri}) {
+		t.Errorf("expected only %s after removing the failed catalog, got %v", uri, c.Catalogs)
+	}
+}
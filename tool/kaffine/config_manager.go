@@ -1,10 +1,13 @@
 package kaffine
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
+	yamlv3 "gopkg.in/yaml.v3"
 	"sigs.k8s.io/yaml"
 )
 
@@ -15,6 +18,38 @@ type Config struct {
 	Dependencies struct {
 		KrmFunctions []string `json:"krmFunctions"`
 	} `json:"dependencies"`
+	// Read by FetchOptions
+	Fetch struct {
+		Workers int    `json:"workers,omitempty"`
+		Timeout string `json:"timeout,omitempty"`
+		Retries *int   `json:"retries,omitempty"`
+		Backoff string `json:"backoff,omitempty"`
+	} `json:"fetch,omitempty"`
+	// Read by HTTPOptions
+	HTTP struct {
+		ConnectTimeout string   `json:"connectTimeout,omitempty"`
+		ReadTimeout    string   `json:"readTimeout,omitempty"`
+		Proxy          string   `json:"proxy,omitempty"`
+		CAFiles        []string `json:"caFiles,omitempty"`
+	} `json:"http,omitempty"`
+	// Settings for single catalogs, by uri
+	CatalogOptions map[string]CatalogOptions `json:"catalogOptions,omitempty"`
+	// Refuse catalogs without a valid signature, even ones with no keys
+	RequireSignatures bool `json:"requireSignatures,omitempty"`
+	// Uris of advisory feeds, on top of the advisories in the catalogs
+	Advisories []string `json:"advisories,omitempty"`
+
+	dirty bool
+	// Parsed file, so comments, key order and unknown fields survive a save
+	document *yamlv3.Node
+}
+
+type CatalogOptions struct {
+	// Used instead of http.proxy for this catalog
+	Proxy string `json:"proxy,omitempty"`
+	// PEM files with the ed25519 or ECDSA keys the catalog may be signed
+	// with. The catalog is only used if its .sig file verifies.
+	PublicKeys []string `json:"publicKeys,omitempty"`
 }
 
 func MakeConfig(directory string) (c Config) {
@@ -22,30 +57,136 @@ func MakeConfig(directory string) (c Config) {
 	filePath := filepath.Join(directory, "config.yaml")
 
 	if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
-		os.WriteFile(filePath, DefaultConfig, 0644)
 		data = DefaultConfig
+		c.dirty = true
 	} else {
 		data, _ = os.ReadFile(filePath)
 	}
 
 	yaml.Unmarshal(data, &c)
 
+	c.document = &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, c.document); err != nil || len(c.document.Content) == 0 {
+		fmt.Fprintf(os.Stderr, "could not parse '%s', comments will not be kept\n", filePath)
+		c.document = &yamlv3.Node{Kind: yamlv3.DocumentNode}
+	}
+
 	c.FilePath = filePath
 	return
 }
 
-func (c *Config) Save() error {
-	data, err := yaml.Marshal(c)
-	if err != nil {
-		return err
+// Renders the config as it would be saved
+func (c *Config) Marshal() ([]byte, error) {
+	if len(c.document.Content) == 0 {
+		c.document.Content = []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}}
+	}
+	root := c.document.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("config '%s' is not a mapping", c.FilePath)
+	}
+
+	setStringSequence(mappingValue(root, "catalogs"), c.Catalogs)
+	setStringSequence(mappingValue(mappingValue(root, "dependencies"), "krmFunctions"), c.Dependencies.KrmFunctions)
+
+	var buf bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
 	}
 
-	file, err := os.Create(c.FilePath)
-	if err != nil {
-		return err
+	return buf.Bytes(), nil
+}
+
+// Only marks the config as changed if the set of catalogs is different
+func (c *Config) SetCatalogs(catalogs []string) {
+	if !sameStrings(c.Catalogs, catalogs) {
+		c.Catalogs = catalogs
+		c.dirty = true
+	}
+}
+
+// Only marks the config as changed if the set of functions is different
+func (c *Config) SetKrmFunctions(krmFunctions []string) {
+	if !sameStrings(c.Dependencies.KrmFunctions, krmFunctions) {
+		c.Dependencies.KrmFunctions = krmFunctions
+		c.dirty = true
+	}
+}
+
+// Returns the value for key, adding the key if it is missing. Null values are
+// turned into mappings.
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node.Kind != yamlv3.MappingNode {
+		node.Kind = yamlv3.MappingNode
+		node.Tag = "!!map"
+		node.Value = ""
+		node.Content = nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	value := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	node.Content = append(node.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, value)
+
+	return value
+}
+
+// Makes node a sequence of values, reusing existing items so their comments
+// are kept
+func setStringSequence(node *yamlv3.Node, values []string) {
+	if len(values) == 0 && node.Kind == yamlv3.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	existing := map[string]*yamlv3.Node{}
+	if node.Kind == yamlv3.SequenceNode {
+		for _, item := range node.Content {
+			existing[item.Value] = item
+		}
+	} else {
+		node.Kind = yamlv3.SequenceNode
+		node.Tag = "!!seq"
+		node.Value = ""
+	}
+	// Empty sequences can only be written as [], don't keep that style
+	if len(node.Content) == 0 {
+		node.Style = 0
+	}
+	node.Content = nil
+
+	for _, value := range values {
+		item, ok := existing[value]
+		if !ok {
+			item = &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value}
+		}
+		node.Content = append(node.Content, item)
+	}
+}
+
+// Compares ignoring order
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := map[string]int{}
+	for _, x := range a {
+		counts[x]++
+	}
+	for _, x := range b {
+		if counts[x] == 0 {
+			return false
+		}
+		counts[x]--
 	}
-	defer file.Close()
 
-	file.Write(data)
-	return nil
+	return true
 }
@@ -0,0 +1,62 @@
+package kaffine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigKeepsComments(t *testing.T) {
+	dir := t.TempDir()
+	original := `# top comment
+catalogs:
+  - https://example.com/a.yaml # first catalog
+  - https://example.com/b.yaml
+dependencies:
+  krmFunctions:
+    # Fixed version
+    - example.com/JavaApplication@v1.0.0
+    - example.com/Logger
+unknown:
+  field: value # keep me
+`
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(original), 0644)
+
+	c := MakeConfig(dir)
+	c.SetCatalogs([]string{"https://example.com/a.yaml", "https://example.com/c.yaml"})
+	c.SetKrmFunctions([]string{"example.com/JavaApplication@v1.0.0", "example.com/SecretSidecar"})
+	data, err := c.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFileAtomic(c.FilePath, data); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	saved := string(b)
+
+	for _, want := range []string{
+		"# top comment",
+		"https://example.com/a.yaml # first catalog",
+		"https://example.com/c.yaml",
+		"# Fixed version\n    - example.com/JavaApplication@v1.0.0",
+		"example.com/SecretSidecar",
+		"field: value # keep me",
+	} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config missing %q:\n%s", want, saved)
+		}
+	}
+	for _, unwanted := range []string{"b.yaml", "example.com/Logger"} {
+		if strings.Contains(saved, unwanted) {
+			t.Errorf("saved config still contains %q:\n%s", unwanted, saved)
+		}
+	}
+
+	reloaded := MakeConfig(dir)
+	if !sameStrings(reloaded.Catalogs, c.Catalogs) || !sameStrings(reloaded.Dependencies.KrmFunctions, c.Dependencies.KrmFunctions) {
+		t.Errorf("reloaded config differs: %v %v", reloaded.Catalogs, reloaded.Dependencies.KrmFunctions)
+	}
+}
@@ -0,0 +1,353 @@
+package kaffine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// Another function that has to be installed for a function to work, because
+// it has to run before it
+type FunctionDependency struct {
+	// group/Kind, or just Kind for a function in the same group
+	Name string `json:"name"`
+	// Exact version or constraint, any version when empty
+	Version string `json:"version,omitempty"`
+}
+
+// The dependencies of version v of fd, from both the definition and the
+// version
+func Dependencies(fd FunctionDefinition, v FunctionVersion) []FunctionDependency {
+	deps := append([]FunctionDependency{}, fd.Dependencies...)
+	deps = append(deps, v.Dependencies...)
+	for i := range deps {
+		if !strings.Contains(deps[i].Name, "/") {
+			deps[i].Name = fd.Group + "/" + deps[i].Name
+		}
+	}
+
+	return deps
+}
+
+func (dep FunctionDependency) String() string {
+	if dep.Version == "" {
+		return dep.Name
+	}
+
+	return dep.Name + "@" + dep.Version
+}
+
+// Why a function is needed: the chain of functions from one that was
+// requested down to the one with the dependency
+type dependencyEdge struct {
+	chain []string
+	dep   FunctionDependency
+}
+
+func (e dependencyEdge) String() string {
+	return fmt.Sprintf("%s requires %s", strings.Join(e.chain, " -> "), e.dep)
+}
+
+// Dependencies that no set of versions satisfies, with every reason the
+// function is needed
+type DependencyConflict struct {
+	Function string
+	Reasons  []string
+	// Requested functions whose dependencies are part of the conflict
+	Roots []string
+}
+
+func (c *DependencyConflict) Error() string {
+	return fmt.Sprintf("cannot resolve the dependencies on %s:\n  - %s", c.Function, strings.Join(c.Reasons, "\n  - "))
+}
+
+type dependencySolver struct {
+	cm     *CatalogManager
+	policy *Policy
+	// Installed and requested functions, which keep their version
+	fixed map[string]FunctionDefinition
+	// Requested functions, to tell them apart from installed ones
+	requested map[string]bool
+	chosen    map[string]FunctionVersion
+	edges     map[string][]dependencyEdge
+}
+
+// Picks versions for the dependencies of fns and theirs in turn. Installed
+// functions and fns keep their version. Every other function gets the highest
+// version that satisfies everything depending on it and the policy, and when
+// that leads to a conflict further down the next highest is tried.
+func (fm *FunctionManager) resolveDependencies(fns []FunctionDefinition) (deps []FunctionDefinition, err error) {
+	return solveDependencies(fm.CatMan, fm.Policy, fm.Installed, fns)
+}
+
+// Like resolveDependencies, with the functions of cm and with installed as the
+// functions that are already there
+func solveDependencies(cm *CatalogManager, policy *Policy, installed map[string]FunctionDefinition, fns []FunctionDefinition) (deps []FunctionDefinition, err error) {
+	s := &dependencySolver{
+		cm:        cm,
+		policy:    policy,
+		fixed:     map[string]FunctionDefinition{},
+		requested: map[string]bool{},
+		chosen:    map[string]FunctionVersion{},
+		edges:     map[string][]dependencyEdge{},
+	}
+	for groupName, fd := range installed {
+		s.fixed[groupName] = fd
+	}
+	for _, fn := range fns {
+		s.fixed[fn.GroupName()] = fn
+		s.requested[fn.GroupName()] = true
+	}
+
+	var pending []string
+	for _, fn := range fns {
+		added, err := s.addEdges(fn, fn.Versions[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, added...)
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	s.cm.Load()
+	if err = s.solve(pending); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.chosen))
+	for name := range s.chosen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dep := s.cm.Functions[name]
+		dep.Versions = []FunctionVersion{s.chosen[name]}
+		if dep.Metadata != nil {
+			dep.Metadata = dep.Metadata.DeepCopy()
+		}
+		SetRequestedVersion(&dep, "")
+		deps = append(deps, dep)
+	}
+
+	return deps, nil
+}
+
+func (s *dependencySolver) solve(pending []string) error {
+	for len(pending) > 0 && s.decided(pending[0]) {
+		pending = pending[1:]
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	name, rest := pending[0], pending[1:]
+
+	fd, ok := s.cm.Functions[name]
+	if !ok {
+		return s.conflict(name, fmt.Sprintf("%s is not in any catalog", name))
+	}
+	candidates, rejected := s.candidates(fd)
+	if len(candidates) == 0 {
+		var available []string
+		for _, v := range fd.Versions {
+			available = append(available, v.Name)
+		}
+		c := s.conflict(name, fmt.Sprintf("%s has no version that satisfies all of these, it has %s", name, strings.Join(available, ", ")))
+		c.Reasons = append(c.Reasons, rejected...)
+		return c
+	}
+
+	// Through the first function that needed it, which is the shortest chain
+	chain := append(append([]string{}, s.edges[name][0].chain...), name)
+	var err error
+	for _, v := range candidates {
+		s.chosen[name] = v
+		chain[len(chain)-1] = name + "@" + v.Name
+
+		var added []string
+		if added, err = s.addEdges(fd, v, chain[:len(chain)-1]); err == nil {
+			if err = s.solve(append(append([]string{}, rest...), added...)); err == nil {
+				return nil
+			}
+		}
+
+		s.removeEdges(fd, v)
+		delete(s.chosen, name)
+	}
+
+	return err
+}
+
+func (s *dependencySolver) decided(name string) bool {
+	_, fixed := s.fixed[name]
+	_, chosen := s.chosen[name]
+
+	return fixed || chosen
+}
+
+// Versions of fd that satisfy every edge to it, highest first. Yanked versions
+// only when an edge asks for them by name. Versions that match but are not
+// allowed by the policy are rejected.
+func (s *dependencySolver) candidates(fd FunctionDefinition) (versions []FunctionVersion, rejected []string) {
+	for _, v := range fd.Versions {
+		ok := !fd.Yanked && !v.Yanked
+		for _, e := range s.edges[fd.GroupName()] {
+			if !MatchesVersion(v.Name, e.dep.Version) && e.dep.Version != "" {
+				ok = false
+				break
+			}
+			if e.dep.Version == v.Name {
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		single := fd
+		single.Versions = []FunctionVersion{v}
+		if err := s.policy.Check(single); err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s@%s is not allowed by %s", fd.GroupName(), v.Name, s.policy.FilePath))
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i].Name, versions[j].Name) > 0
+	})
+
+	return versions, rejected
+}
+
+// Records the dependencies of version v of fd, which is needed through chain.
+// Returns the dependencies that still need a version, or a conflict with one
+// that already has one.
+func (s *dependencySolver) addEdges(fd FunctionDefinition, v FunctionVersion, chain []string) (pending []string, err error) {
+	chain = append(append([]string{}, chain...), fd.GroupName()+"@"+v.Name)
+	for _, dep := range Dependencies(fd, v) {
+		s.edges[dep.Name] = append(s.edges[dep.Name], dependencyEdge{chain: chain, dep: dep})
+
+		version := ""
+		if fixed, ok := s.fixed[dep.Name]; ok && len(fixed.Versions) > 0 {
+			version = fixed.Versions[0].Name
+		} else if chosen, ok := s.chosen[dep.Name]; ok {
+			version = chosen.Name
+		} else {
+			pending = append(pending, dep.Name)
+			continue
+		}
+
+		if dep.Version != "" && !MatchesVersion(version, dep.Version) {
+			err = s.conflict(dep.Name, "")
+			s.removeEdges(fd, v)
+			return nil, err
+		}
+	}
+
+	return pending, nil
+}
+
+// Undoes addEdges
+func (s *dependencySolver) removeEdges(fd FunctionDefinition, v FunctionVersion) {
+	from := fd.GroupName() + "@" + v.Name
+	for _, dep := range Dependencies(fd, v) {
+		edges := s.edges[dep.Name]
+		for i := len(edges) - 1; i >= 0; i-- {
+			if chain := edges[i].chain; chain[len(chain)-1] == from {
+				edges = append(edges[:i], edges[i+1:]...)
+				break
+			}
+		}
+		s.edges[dep.Name] = edges
+	}
+}
+
+// Explains why name cannot be resolved, with every edge to it and the version
+// it is stuck with, if any
+func (s *dependencySolver) conflict(name string, reason string) *DependencyConflict {
+	c := &DependencyConflict{Function: name}
+	roots := map[string]bool{}
+	for _, e := range s.edges[name] {
+		c.Reasons = append(c.Reasons, e.String())
+		group, kind, _ := ToGroupNameVersion(e.chain[0])
+		if root := group + "/" + kind; s.requested[root] && !roots[root] {
+			roots[root] = true
+			c.Roots = append(c.Roots, root)
+		}
+	}
+
+	if fixed, ok := s.fixed[name]; ok && len(fixed.Versions) > 0 {
+		state := "is installed"
+		if s.requested[name] {
+			state = "was requested"
+			if !roots[name] {
+				c.Roots = append(c.Roots, name)
+			}
+		}
+		c.Reasons = append(c.Reasons, fmt.Sprintf("%s@%s %s", name, fixed.Versions[0].Name, state))
+	} else if v, ok := s.chosen[name]; ok {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("%s@%s was picked first", name, v.Name))
+	}
+	if reason != "" {
+		c.Reasons = append(c.Reasons, reason)
+	}
+
+	return c
+}
+
+// Installed functions, other than the ones in except, that depend on
+// groupName
+func (fm *FunctionManager) Dependents(groupName string, except map[string]bool) (dependents []string) {
+	for _, name := range fm.InstalledNames() {
+		fd := fm.Installed[name]
+		if except[name] || len(fd.Versions) == 0 {
+			continue
+		}
+		for _, dep := range Dependencies(fd, fd.Versions[0]) {
+			if dep.Name == groupName {
+				dependents = append(dependents, name+"@"+fd.Versions[0].Name)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// A function whose dependency is missing or at a version it does not accept
+type dependencyProblem struct {
+	Function   string
+	Dependency string
+	Err        error
+}
+
+// Every dependency problem among the functions in installed
+func dependencyProblems(installed map[string]FunctionDefinition) (problems []dependencyProblem) {
+	names := maps.Keys(installed)
+	sort.Strings(names)
+	for _, groupName := range names {
+		fd := installed[groupName]
+		if len(fd.Versions) == 0 {
+			continue
+		}
+		for _, dep := range Dependencies(fd, fd.Versions[0]) {
+			p := dependencyProblem{Function: groupName, Dependency: dep.Name}
+			target, ok := installed[dep.Name]
+			switch {
+			case !ok || len(target.Versions) == 0:
+				p.Err = fmt.Errorf("%s@%s requires %s, which would not be installed", groupName, fd.Versions[0].Name, dep)
+			case dep.Version != "" && !MatchesVersion(target.Versions[0].Name, dep.Version):
+				p.Err = fmt.Errorf("%s@%s requires %s, which would be at %s", groupName, fd.Versions[0].Name, dep, target.Versions[0].Name)
+			default:
+				continue
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,192 @@
+package kaffine
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func makeDependencyFunction(kind string, versions map[string][]FunctionDependency) FunctionDefinition {
+	fd := FunctionDefinition{Group: "example.com"}
+	fd.Names.Kind = kind
+	for name, deps := range versions {
+		fd.Versions = append(fd.Versions, FunctionVersion{Name: name, Dependencies: deps})
+	}
+	sort.Slice(fd.Versions, func(i, j int) bool {
+		return CompareVersions(fd.Versions[i].Name, fd.Versions[j].Name) < 0
+	})
+
+	return fd
+}
+
+func makeDependencyManager(installed []FunctionDefinition, fns ...FunctionDefinition) *FunctionManager {
+	cm := &CatalogManager{Functions: map[string]FunctionDefinition{}, loaded: true}
+	for _, fn := range fns {
+		cm.Functions[fn.GroupName()] = fn
+	}
+	fm := &FunctionManager{CatMan: cm, Installed: map[string]FunctionDefinition{}}
+	for _, fd := range installed {
+		fm.Installed[fd.GroupName()] = fd
+	}
+
+	return fm
+}
+
+func only(fd FunctionDefinition, version string) FunctionDefinition {
+	v, _ := fd.GetVersion(version)
+	fd.Versions = []FunctionVersion{v}
+
+	return fd
+}
+
+func TestResolveDependencies(t *testing.T) {
+	app := makeDependencyFunction("App", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Sidecar", Version: "^1"}},
+	})
+	sidecar := makeDependencyFunction("Sidecar", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Base"}},
+		"v1.1.0": {{Name: "Base", Version: "^2"}},
+		"v2.0.0": nil,
+	})
+	base := makeDependencyFunction("Base", map[string][]FunctionDependency{
+		"v1.0.0": nil,
+		"v1.2.0": nil,
+	})
+	logger := makeDependencyFunction("Logger", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "example.com/Base", Version: "v1.0.0"}},
+	})
+	strict := makeDependencyFunction("Strict", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Base", Version: "^3"}},
+	})
+	orphan := makeDependencyFunction("Orphan", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Missing"}},
+	})
+
+	var tests = []struct {
+		name      string
+		installed []FunctionDefinition
+		requested []FunctionDefinition
+		deps      []string
+		conflict  []string
+	}{
+		{"no dependencies", nil, []FunctionDefinition{only(base, "v1.2.0")}, nil, nil},
+		// Sidecar v1.1.0 needs a Base v2 that does not exist, so v1.0.0
+		{"transitive with backtracking", nil, []FunctionDefinition{only(app, "v1.0.0")},
+			[]string{"example.com/Base@v1.2.0", "example.com/Sidecar@v1.0.0"}, nil},
+		{"shared dependency", nil, []FunctionDefinition{only(app, "v1.0.0"), only(logger, "v1.0.0")},
+			[]string{"example.com/Base@v1.0.0", "example.com/Sidecar@v1.0.0"}, nil},
+		{"installed dependency", []FunctionDefinition{only(base, "v1.2.0")}, []FunctionDefinition{only(app, "v1.0.0")},
+			[]string{"example.com/Sidecar@v1.0.0"}, nil},
+		{"installed dependency conflict", []FunctionDefinition{only(base, "v1.2.0")}, []FunctionDefinition{only(logger, "v1.0.0")}, nil,
+			[]string{"example.com/Logger@v1.0.0 requires example.com/Base@v1.0.0", "example.com/Base@v1.2.0 is installed"}},
+		{"no version", nil, []FunctionDefinition{only(strict, "v1.0.0")}, nil,
+			[]string{"example.com/Strict@v1.0.0 requires example.com/Base@^3", "example.com/Base has no version that satisfies all of these, it has v1.0.0, v1.2.0"}},
+		{"transitive conflict", nil, []FunctionDefinition{only(app, "v1.0.0"), only(strict, "v1.0.0")}, nil,
+			[]string{"example.com/Strict@v1.0.0 requires example.com/Base@^3", "example.com/App@v1.0.0 -> example.com/Sidecar@v1.0.0 requires example.com/Base", "example.com/Base has no version that satisfies all of these, it has v1.0.0, v1.2.0"}},
+		{"not in any catalog", nil, []FunctionDefinition{only(orphan, "v1.0.0")}, nil,
+			[]string{"example.com/Orphan@v1.0.0 requires example.com/Missing", "example.com/Missing is not in any catalog"}},
+	}
+
+	for _, test := range tests {
+		fm := makeDependencyManager(test.installed, app, sidecar, base, logger, strict, orphan)
+		deps, err := fm.resolveDependencies(test.requested)
+
+		var names []string
+		for _, dep := range deps {
+			names = append(names, dep.GroupName()+"@"+dep.Versions[0].Name)
+		}
+		if !reflect.DeepEqual(names, test.deps) {
+			t.Errorf("%s: expected dependencies %v, got %v", test.name, test.deps, names)
+		}
+
+		var reasons []string
+		if conflict, ok := err.(*DependencyConflict); ok {
+			reasons = conflict.Reasons
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if !reflect.DeepEqual(reasons, test.conflict) {
+			t.Errorf("%s: expected conflict\n  %s\ngot\n  %s", test.name, strings.Join(test.conflict, "\n  "), strings.Join(reasons, "\n  "))
+		}
+	}
+}
+
+func TestRemoveNeededFunction(t *testing.T) {
+	sidecar := makeDependencyFunction("Sidecar", map[string][]FunctionDependency{"v1.0.0": nil})
+	app := makeDependencyFunction("App", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Sidecar"}},
+	})
+
+	var tests = []struct {
+		fnames []string
+		force  bool
+		ok     bool
+	}{
+		{[]string{"Sidecar"}, false, false},
+		{[]string{"Sidecar"}, true, true},
+		{[]string{"Sidecar", "App"}, false, true},
+		{[]string{"App"}, false, true},
+	}
+
+	for _, test := range tests {
+		fm := makeDependencyManager([]FunctionDefinition{sidecar, app})
+		_, err := fm.RemoveFunctionDefinitions(test.fnames, false, test.force)
+		if (err == nil) != test.ok {
+			t.Errorf("removing %v with force %v: expected ok %v, got %v", test.fnames, test.force, test.ok, err)
+		}
+	}
+}
+
+func TestAddConflictingFunctions(t *testing.T) {
+	base := makeDependencyFunction("Base", map[string][]FunctionDependency{"v1.0.0": nil, "v1.2.0": nil})
+	logger := makeDependencyFunction("Logger", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Base", Version: "v1.0.0"}},
+	})
+	modern := makeDependencyFunction("Modern", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Base", Version: "^1.2"}},
+	})
+
+	var tests = []struct {
+		fnames    []string
+		keepGoing bool
+		installed []string
+	}{
+		// Each can be installed on its own, so the one requested last fails
+		{[]string{"Logger", "Modern"}, true, []string{"example.com/Base@v1.0.0", "example.com/Logger@v1.0.0"}},
+		{[]string{"Modern", "Logger"}, true, []string{"example.com/Base@v1.2.0", "example.com/Modern@v1.0.0"}},
+		{[]string{"Logger", "Modern"}, false, nil},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "catalog.yaml")
+		writeCatalog(t, path, base, logger, modern)
+
+		fm, err := NewFunctionManager(dir, ExclusiveLock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = fm.CatMan.AddCatalog("file://" + path); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := fm.AddFunctionDefinitions(test.fnames, test.keepGoing)
+		if err == nil {
+			t.Errorf("%v: expected a conflict", test.fnames)
+		}
+		if len(results) < 2 || results[1].Action != "failed" {
+			t.Errorf("%v: expected %s to fail, got %v", test.fnames, test.fnames[1], results)
+		}
+
+		var installed []string
+		for _, groupName := range fm.InstalledNames() {
+			installed = append(installed, groupName+"@"+fm.Installed[groupName].Versions[0].Name)
+		}
+		if !reflect.DeepEqual(installed, test.installed) {
+			t.Errorf("%v with keepGoing %v: expected %v installed, got %v", test.fnames, test.keepGoing, test.installed, installed)
+		}
+		fm.Close()
+	}
+}
@@ -0,0 +1,96 @@
+package kaffine
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// How catalogs are fetched, from the fetch section of the config
+type FetchOptions struct {
+	// Catalogs fetched at the same time
+	Workers int
+	// Limit for a single attempt
+	Timeout time.Duration
+	// Attempts after the first one fails
+	Retries int
+	// Wait before the first retry, doubled before each one after
+	Backoff time.Duration
+}
+
+var DefaultFetchOptions = FetchOptions{
+	Workers: 4,
+	Timeout: 30 * time.Second,
+	Retries: 2,
+	Backoff: 500 * time.Millisecond,
+}
+
+// The fetch section of the config, with defaults for what it leaves out
+func (c *Config) FetchOptions() (opts FetchOptions, err error) {
+	opts = DefaultFetchOptions
+
+	if c.Fetch.Workers < 0 {
+		return opts, fmt.Errorf("fetch.workers must be at least 1, got %d", c.Fetch.Workers)
+	}
+	if c.Fetch.Workers > 0 {
+		opts.Workers = c.Fetch.Workers
+	}
+	if c.Fetch.Retries != nil {
+		if *c.Fetch.Retries < 0 {
+			return opts, fmt.Errorf("fetch.retries cannot be negative, got %d", *c.Fetch.Retries)
+		}
+		opts.Retries = *c.Fetch.Retries
+	}
+	if c.Fetch.Timeout != "" {
+		if opts.Timeout, err = time.ParseDuration(c.Fetch.Timeout); err != nil {
+			return opts, fmt.Errorf("fetch.timeout: %v", err)
+		}
+	}
+	if c.Fetch.Backoff != "" {
+		if opts.Backoff, err = time.ParseDuration(c.Fetch.Backoff); err != nil {
+			return opts, fmt.Errorf("fetch.backoff: %v", err)
+		}
+	}
+
+	return opts, nil
+}
+
+// Fetches the catalogs at uris, up to Fetch.Workers at a time. Results are in
+// the same order as uris, whichever fetch finishes first.
+func (cm *CatalogManager) fetchAll(uris []string) (fcs []FunctionCatalog, errs []error) {
+	fcs = make([]FunctionCatalog, len(uris))
+	errs = make([]error, len(uris))
+
+	workers := cm.Fetch.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	slots := make(chan struct{}, workers)
+
+	var wg sync.WaitGroup
+	for i, uri := range uris {
+		wg.Add(1)
+		go func(i int, uri string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			fcs[i], errs[i] = cm.GetExternalCatalog(uri)
+		}(i, uri)
+	}
+	wg.Wait()
+
+	return fcs, errs
+}
+
+// Reads a file belonging to a catalog, or downloads it through the catalog's
+// proxy
+func (cm *CatalogManager) fetchCatalogData(catalog string, u *url.URL) ([]byte, error) {
+	if u.Scheme == "file" {
+		return os.ReadFile(u.Path)
+	}
+
+	return cm.HTTP.Get(u.String(), cm.Options[catalog].Proxy)
+}
@@ -0,0 +1,133 @@
+package kaffine
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchAll(t *testing.T) {
+	var mu sync.Mutex
+	var active, maxActive int32
+	attempts := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		mu.Lock()
+		if n > maxActive {
+			maxActive = n
+		}
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/slow":
+			// Finishes last, but must still come first
+			time.Sleep(100 * time.Millisecond)
+		case "/flaky":
+			// Times out the first time
+			if attempt == 1 {
+				time.Sleep(300 * time.Millisecond)
+			}
+		}
+		fmt.Fprint(w, testCatalog)
+	}))
+	defer server.Close()
+
+	cm := MakeCatalogManager(t.TempDir())
+	cm.Fetch = FetchOptions{Workers: 2, Timeout: 150 * time.Millisecond, Retries: 1, Backoff: time.Millisecond}
+	cm.HTTP, _ = NewHTTPClient(DefaultHTTPOptions, cm.Fetch)
+
+	uris := []string{server.URL + "/slow", server.URL + "/flaky", server.URL + "/a", server.URL + "/b"}
+	fcs, errs := cm.fetchAll(uris)
+	for i, uri := range uris {
+		if errs[i] != nil {
+			t.Errorf("%s: %v", uri, errs[i])
+		} else if len(fcs[i].Spec.KrmFunctions) != 1 {
+			t.Errorf("%s: got %d functions, want 1", uri, len(fcs[i].Spec.KrmFunctions))
+		}
+	}
+	if maxActive > 2 {
+		t.Errorf("%d fetches at once, want at most 2", maxActive)
+	}
+	if attempts["/flaky"] != 2 {
+		t.Errorf("flaky catalog fetched %d times, want 2", attempts["/flaky"])
+	}
+
+	// Without retries the timeout is an error
+	attempts["/flaky"] = 0
+	cm.HTTP.Retries = 0
+	if _, errs = cm.fetchAll([]string{server.URL + "/flaky"}); errs[0] == nil {
+		t.Error("expected timeout")
+	}
+}
+
+func TestFetchLatestIsDeterministic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first catalog is the slowest, but still wins the conflict
+		if r.URL.Path == "/first" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		fmt.Fprint(w, strings.Replace(testCatalog, "logger:v1.0.0", "logger"+r.URL.Path, 1))
+	}))
+	defer server.Close()
+
+	first, second := server.URL+"/first", server.URL+"/second"
+	cm := MakeCatalogManager(t.TempDir())
+	cm.loaded = true
+	cm.Fetch.Workers = 2
+	if err := cm.insertCatalog(first, MakeFunctionCatalog("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.insertCatalog(second, MakeFunctionCatalog("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, errs := cm.FetchLatest(cm.URIs)
+	if errs[first] != nil || errs[second] == nil {
+		t.Fatalf("want a conflict for the second catalog only, got %v", errs)
+	}
+	if image := latest.Functions["example.com/Logger"].Versions[0].Runtime.Container.Image; image != "logger/first" {
+		t.Errorf("got image %s from the wrong catalog", image)
+	}
+}
+
+func TestFetchLatestConflictWithUnfetchedCatalog(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.yaml"), filepath.Join(dir, "second.yaml")
+	writeCatalog(t, first)
+	writeHistoryCatalog(t, second, "v1.0.0")
+
+	runHistoryCommand(t, dir, "config add-catalog", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog("file://" + first); err != nil {
+			return err
+		}
+		return fm.CatMan.AddCatalog("file://" + second)
+	})
+	// Only the first catalog is fetched again, and now has Logger too
+	writeHistoryCatalog(t, first, "v2.0.0")
+
+	fm, err := NewFunctionManager(dir, ExclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	plan, err := fm.PlanUpdate(UpdateOptions{Catalogs: []string{"file://" + first}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Err() == nil {
+		t.Errorf("expected the update to be refused, got %v", plan.Catalogs)
+	}
+	if err = fm.ApplyPlan(plan); err == nil || len(fm.CatMan.URIs) != 2 {
+		t.Errorf("expected both catalogs to be kept, got %v (%v)", fm.CatMan.URIs, err)
+	}
+}
@@ -0,0 +1,64 @@
+package kaffine
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Writes to a temporary file first, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp-" + strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// Replaces the contents of dir with files, keyed by path relative to dir. The
+// new contents are written next to dir and swapped in, so on failure dir is
+// left as it was.
+func replaceDir(dir string, files map[string][]byte) error {
+	suffix := strconv.Itoa(os.Getpid())
+	tmp := dir + ".tmp-" + suffix
+	old := dir + ".old-" + suffix
+	os.RemoveAll(tmp)
+
+	for name, data := range files {
+		path := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+	if err := os.MkdirAll(tmp, os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.Rename(old, dir)
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	return os.RemoveAll(old)
+}
@@ -1,13 +1,16 @@
 package kaffine
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"golang.org/x/exp/maps"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"golang.org/x/exp/slices"
 	"sigs.k8s.io/yaml"
 )
 
@@ -18,24 +21,51 @@ type FunctionManager struct {
 	Cfg    *Config
 
 	Installed map[string]FunctionDefinition
+	// Checked before installing or updating anything, nil without a policy
+	Policy *Policy
+
+	// Recorded in the history, e.g. "install"
+	Operation string
+
+	// Picks between functions when a name is ambiguous, e.g. Choose when
+	// attached to a terminal. Ambiguous names are an error when it is nil.
+	Picker func(question string, options []string) (int, error)
+
+	lock  *FileLock
+	dirty bool
+	// installed.json is missing or out of date, without anything having
+	// changed
+	stateDirty bool
+	// State when loaded, to diff against in the history
+	loaded map[string]FunctionDefinition
+	// By feed uri, fetched by the first call to Advisories
+	feedAdvisories map[string][]Advisory
 }
 
-func NewFunctionManager(directory string) *FunctionManager {
+// Acquires the directory lock before loading anything. Commands that only read
+// state should pass SharedLock so they can run alongside each other.
+func NewFunctionManager(directory string, mode LockMode) (*FunctionManager, error) {
 	fm := FunctionManager{}
 
 	fm.Directory = directory
+
+	lock, err := AcquireLock(directory, mode, LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	fm.lock = lock
+
 	catman := MakeCatalogManager(directory)
 	fm.CatMan = &catman
 	cfg := MakeConfig(directory)
 	fm.Cfg = &cfg
 
-	for _, uri := range fm.Cfg.Catalogs {
-		err := fm.CatMan.AddCatalog(uri)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v", err)
-		}
+	if err = fm.configureFetching(); err != nil {
+		lock.Release()
+		return nil, fmt.Errorf("config '%s': %v", fm.Cfg.FilePath, err)
 	}
-	fm.Cfg.Catalogs = maps.Keys(fm.CatMan.Catalogs)
+	// Catalogs are parsed by CatMan.Load once something needs them
+	fm.CatMan.URIs = append([]string{}, fm.Cfg.Catalogs...)
 
 	// LIST CACHE
 	// .    .     - Do nothing
@@ -43,66 +73,209 @@ func NewFunctionManager(directory string) *FunctionManager {
 	// x    .     - Attempt to fetch catalog and load into memory
 	// x    x     - Load into memory
 
-	fm.Installed = map[string]FunctionDefinition{}
-	for _, fname := range fm.Cfg.Dependencies.KrmFunctions {
-		// FIXME: Extremely inefficient!
-		_, err := fm.AddFunctionDefinition(fname)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v", err)
-			continue
+	var ok bool
+	if fm.Installed, ok = fm.readInstalledState(); !ok {
+		// Resolve the dependencies one by one, from the function cache or
+		// else the catalogs. The functions they depend on are listed in the
+		// config as well, with their own pins.
+		fm.Installed = map[string]FunctionDefinition{}
+		for _, fname := range fm.Cfg.Dependencies.KrmFunctions {
+			_, err := fm.addFunctionDefinition(fname)
+			if err != nil {
+				fmt.Fprintln(Stderr, err)
+				continue
+			}
 		}
+		fm.stateDirty = true
+	}
+	// Loading what is already on disk is not a change
+	fm.dirty = false
+	fm.loaded = maps.Clone(fm.Installed)
+
+	// Only loaded now, so functions installed before a rule was added are
+	// not blocked from loading
+	if fm.Policy, err = LoadPolicy(directory); err != nil {
+		lock.Release()
+		return nil, err
 	}
 
-	return &fm
+	return &fm, nil
+}
+
+// Sets up how the catalog manager downloads catalogs from the config
+func (fm *FunctionManager) configureFetching() (err error) {
+	if fm.CatMan.Fetch, err = fm.Cfg.FetchOptions(); err != nil {
+		return err
+	}
+	httpOpts, err := fm.Cfg.HTTPOptions()
+	if err != nil {
+		return err
+	}
+	if fm.CatMan.HTTP, err = NewHTTPClient(httpOpts, fm.CatMan.Fetch); err != nil {
+		return err
+	}
+	fm.CatMan.Options = fm.Cfg.CatalogOptions
+	fm.CatMan.RequireSignatures = fm.Cfg.RequireSignatures
+	fm.CatMan.AllowUnsigned = AllowUnsigned
+
+	return nil
+}
+
+// Releases the directory lock. The FunctionManager must not be used afterwards.
+func (fm *FunctionManager) Close() error {
+	return fm.lock.Release()
 }
 
 func (fm *FunctionManager) Save() error {
+	if fm.lock == nil || fm.lock.Mode != ExclusiveLock {
+		return errors.New("attempted to save without holding the exclusive lock")
+	}
+
 	fm.UpdateConfig()
 
-	os.RemoveAll(filepath.Join(fm.Directory, "functions"))
-	for _, groupName := range maps.Keys(fm.Installed) {
-		fm.SaveFunctionDefinition(groupName)
+	// Render everything before writing anything, so a marshalling error
+	// leaves the directory untouched
+	changed := fm.dirty || fm.Cfg.dirty || fm.CatMan.dirty
+	var err error
+	var functionFiles, catalogFiles map[string][]byte
+	var installedCatalog, config, index, state []byte
+	if fm.dirty {
+		if functionFiles, err = fm.functionFiles(); err != nil {
+			return err
+		}
+		if installedCatalog, err = fm.GenerateInstalledCatalog(); err != nil {
+			return err
+		}
+	}
+	if fm.Cfg.dirty {
+		if config, err = fm.Cfg.Marshal(); err != nil {
+			return err
+		}
+	}
+	writeState := fm.dirty || fm.stateDirty
+	if writeState {
+		if state, err = fm.marshalInstalledState(); err != nil {
+			return err
+		}
+	}
+	if fm.CatMan.dirty {
+		if catalogFiles, err = fm.CatMan.files(); err != nil {
+			return err
+		}
+	}
+	if fm.CatMan.Index.dirty {
+		if index, err = fm.CatMan.Index.Marshal(); err != nil {
+			return err
+		}
 	}
 
-	if installedCatalog, err := fm.GenerateInstalledCatalog(); err != nil {
-		return err
-	} else {
-		os.WriteFile(filepath.Join(fm.Directory, "installed.yaml"), installedCatalog, os.ModePerm)
+	if fm.dirty {
+		if err := replaceDir(filepath.Join(fm.Directory, "functions"), functionFiles); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(fm.Directory, "installed.yaml"), installedCatalog); err != nil {
+			return err
+		}
+		fm.dirty = false
+	}
+	if fm.CatMan.dirty {
+		if err := replaceDir(fm.CatMan.Directory, catalogFiles); err != nil {
+			return err
+		}
+		fm.CatMan.dirty = false
+	}
+	if writeState {
+		if err := writeFileAtomic(fm.statePath(), state); err != nil {
+			return err
+		}
+		fm.stateDirty = false
+	}
+	if fm.CatMan.Index.dirty {
+		if err := writeFileAtomic(fm.CatMan.Index.FilePath, index); err != nil {
+			return err
+		}
+		fm.CatMan.Index.dirty = false
+	}
+	if fm.Cfg.dirty {
+		if err := writeFileAtomic(fm.Cfg.FilePath, config); err != nil {
+			return err
+		}
+		fm.Cfg.dirty = false
 	}
 
-	if err := fm.Cfg.Save(); err != nil {
-		return err
+	if changed {
+		return fm.recordHistory()
 	}
-	if err := fm.CatMan.Save(); err != nil {
-		return err
+
+	return nil
+}
+
+// Writes what a read-only command rebuilt only to speed up the next one: the
+// search index and installed.json, and only when they were missing or out of
+// date, so a read-only command in an up to date directory writes nothing.
+// Both are derived from files the shared lock keeps unchanged and written
+// atomically, so they are safe to write while other readers run.
+func (fm *FunctionManager) SaveCaches() error {
+	if fm.stateDirty && !fm.dirty {
+		state, err := fm.marshalInstalledState()
+		if err != nil {
+			return err
+		}
+		if err = writeFileAtomic(fm.statePath(), state); err != nil {
+			return err
+		}
+		fm.stateDirty = false
+	}
+	if fm.CatMan.Index != nil && fm.CatMan.Index.dirty {
+		index, err := fm.CatMan.Index.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = writeFileAtomic(fm.CatMan.Index.FilePath, index); err != nil {
+			return err
+		}
+		fm.CatMan.Index.dirty = false
 	}
 
 	return nil
 }
 
-func (fm *FunctionManager) SaveFunctionDefinition(fname string) (fd FunctionDefinition, error error) {
-	group, name, _ := ToGroupNameVersion(fname)
-	groupName := group + "/" + name
-	fd, ok := fm.Installed[groupName]
-	if !ok {
-		return fd, fmt.Errorf("function '%s' not installed (check spelling?)", groupName)
+// Cached definitions of the installed functions, by path in functions/
+func (fm *FunctionManager) functionFiles() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, groupName := range fm.InstalledNames() {
+		fd := fm.Installed[groupName]
+		b, err := yaml.Marshal(fd)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(fd.Group, fd.Names.Kind+".yaml")] = b
 	}
 
-	fnDir := filepath.Join(fm.Directory, "functions", fd.Group)
-	// fmt.Println(fnDir)
-	fnFile := fd.Names.Kind + ".yaml"
+	return files, nil
+}
 
-	os.MkdirAll(fnDir, os.ModePerm)
-	b, err := yaml.Marshal(fd)
-	if err != nil {
-		return fd, err
+// Installs a function along with the functions it depends on, which are
+// returned in deps
+func (fm *FunctionManager) AddFunctionDefinition(fname string) (fn FunctionDefinition, deps []FunctionDefinition, err error) {
+	dirty := fm.dirty
+	if fn, err = fm.addFunctionDefinition(fname); err != nil {
+		return
+	}
+
+	if deps, err = fm.resolveDependencies([]FunctionDefinition{fn}); err != nil {
+		delete(fm.Installed, fn.GroupName())
+		fm.dirty = dirty
+		return fn, nil, err
+	}
+	for _, dep := range deps {
+		fm.Installed[dep.GroupName()] = dep
 	}
-	os.WriteFile(filepath.Join(fnDir, fnFile), b, os.ModePerm)
 
-	return fd, nil
+	return fn, deps, nil
 }
 
-func (fm *FunctionManager) AddFunctionDefinition(fname string) (fn FunctionDefinition, err error) {
+func (fm *FunctionManager) addFunctionDefinition(fname string) (fn FunctionDefinition, err error) {
 	group, name, _ := ToGroupNameVersion(fname)
 	groupName := group + "/" + name
 	if _, ok := fm.Installed[groupName]; ok {
@@ -121,26 +294,240 @@ func (fm *FunctionManager) AddFunctionDefinition(fname string) (fn FunctionDefin
 	if _, ok := fm.Installed[fn.GroupName()]; ok {
 		return fn, fmt.Errorf("function '%s' already installed", fn.GroupName())
 	}
+	if err = fm.Policy.Check(fn); err != nil {
+		return fn, err
+	}
 
 	fm.Installed[fn.GroupName()] = fn
+	fm.dirty = true
 
 	return fn, nil
 }
 
-func (fm *FunctionManager) RemoveFunctionDefinition(fname string) (oldFd FunctionDefinition, err error) {
-	group, name, _ := ToGroupNameVersion(fname)
-	groupName := group + "/" + name
+// Installs several functions. Every name is resolved before anything is
+// installed. Unless keepGoing is set, a single failure means nothing is
+// installed; otherwise the functions that could be resolved are installed
+// anyway. Either way there is a result for every name, in order.
+func (fm *FunctionManager) AddFunctionDefinitions(fnames []string, keepGoing bool) (results FunctionResults, err error) {
+	fns := make([]FunctionDefinition, len(fnames))
+	errs := make([]error, len(fnames))
+
+	// Names that are not in the cache are searched for all at once
+	var external []string
+	var externalIdx []int
+	for i, fname := range fnames {
+		fns[i], errs[i] = fm.GetCachedFunctionDefinition(fname)
+		if errs[i] != nil {
+			external = append(external, fname)
+			externalIdx = append(externalIdx, i)
+		}
+	}
+	fnss, _ := fm.CatMan.SearchMultiple(external)
+	for j, i := range externalIdx {
+		fns[i], errs[i] = fm.pickSearchResult(fnames[i], fnss[j])
+	}
+
+	seen := map[string]string{}
+	for i, fn := range fns {
+		if errs[i] != nil {
+			continue
+		}
+		if _, ok := fm.Installed[fn.GroupName()]; ok {
+			errs[i] = fmt.Errorf("function '%s' already installed", fn.GroupName())
+		} else if err := fm.Policy.Check(fn); err != nil {
+			errs[i] = err
+		} else if other, ok := seen[fn.GroupName()]; ok {
+			errs[i] = fmt.Errorf("function '%s' also requested as '%s'", fn.GroupName(), other)
+		} else {
+			seen[fn.GroupName()] = fnames[i]
+		}
+	}
+
+	// The functions they depend on are resolved together, so they agree on
+	// the versions. The functions caught up in a conflict fail, and with
+	// keepGoing the rest are resolved again without them. There only the
+	// ones that cannot be installed on their own fail, or when they only
+	// conflict with each other the one requested last.
+	var deps []FunctionDefinition
+	for {
+		var requested []FunctionDefinition
+		for i, fn := range fns {
+			if errs[i] == nil {
+				requested = append(requested, fn)
+			}
+		}
+		var depErr error
+		if deps, depErr = fm.resolveDependencies(requested); depErr == nil {
+			break
+		}
+
+		culprits := map[int]bool{}
+		conflict, ok := depErr.(*DependencyConflict)
+		for i, fn := range fns {
+			if errs[i] == nil && (!ok || len(conflict.Roots) == 0 || slices.Contains(conflict.Roots, fn.GroupName())) {
+				culprits[i] = true
+			}
+		}
+		if keepGoing && len(culprits) > 1 {
+			last := 0
+			for i := range culprits {
+				if _, err := fm.resolveDependencies([]FunctionDefinition{fns[i]}); err == nil {
+					delete(culprits, i)
+				}
+				if i > last {
+					last = i
+				}
+			}
+			if len(culprits) == 0 {
+				culprits[last] = true
+			}
+		}
+		for i := range culprits {
+			errs[i] = depErr
+		}
+		if !keepGoing {
+			break
+		}
+	}
+
+	failed := 0
+	for _, e := range errs {
+		if e != nil {
+			failed++
+		}
+	}
+	apply := failed == 0 || keepGoing
+
+	for i, fn := range fns {
+		switch {
+		case errs[i] != nil:
+			results = append(results, FunctionResult{Action: "failed", Function: fnames[i], Error: errs[i].Error()})
+		case apply:
+			fm.Installed[fn.GroupName()] = fn
+			fm.dirty = true
+			results = append(results, fm.MakeFunctionResult("installed", fn))
+		default:
+			results = append(results, fm.MakeFunctionResult("skipped", fn))
+		}
+	}
+	if apply {
+		for _, dep := range deps {
+			fm.Installed[dep.GroupName()] = dep
+			results = append(results, fm.MakeFunctionResult("dependency", dep))
+		}
+	}
+
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d functions could not be installed", failed, len(fnames))
+	}
 
-	if _, ok := fm.Installed[fname]; !ok {
-		return oldFd, fmt.Errorf("function with name '%s' not installed", groupName)
+	return results, err
+}
+
+// Removes several functions, with the same all or nothing behavior as
+// AddFunctionDefinitions. Functions that other installed functions depend on
+// are only removed with force.
+func (fm *FunctionManager) RemoveFunctionDefinitions(fnames []string, keepGoing bool, force bool) (results FunctionResults, err error) {
+	groupNames := make([]string, len(fnames))
+	errs := make([]error, len(fnames))
+
+	seen := map[string]string{}
+	for i, fname := range fnames {
+		groupNames[i], errs[i] = fm.InstalledName(fname)
+		if errs[i] != nil {
+			continue
+		}
+		if other, ok := seen[groupNames[i]]; ok {
+			errs[i] = fmt.Errorf("function '%s' also requested as '%s'", groupNames[i], other)
+		} else {
+			seen[groupNames[i]] = fname
+		}
+	}
+
+	if !force {
+		removed := map[string]bool{}
+		for i, groupName := range groupNames {
+			if errs[i] == nil {
+				removed[groupName] = true
+			}
+		}
+		for i, groupName := range groupNames {
+			if errs[i] != nil {
+				continue
+			}
+			if dependents := fm.Dependents(groupName, removed); len(dependents) > 0 {
+				errs[i] = fmt.Errorf("function '%s' is needed by %s, use --force to remove it anyway", groupName, strings.Join(dependents, ", "))
+			}
+		}
+	}
+
+	failed := 0
+	for _, e := range errs {
+		if e != nil {
+			failed++
+		}
+	}
+	apply := failed == 0 || keepGoing
+
+	for i, groupName := range groupNames {
+		switch {
+		case errs[i] != nil:
+			results = append(results, FunctionResult{Action: "failed", Function: fnames[i], Error: errs[i].Error()})
+		case apply:
+			oldFd, _ := fm.RemoveFunctionDefinition(groupName)
+			results = append(results, fm.MakeFunctionResult("removed", oldFd))
+		default:
+			results = append(results, fm.MakeFunctionResult("skipped", fm.Installed[groupName]))
+		}
+	}
+
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d functions could not be removed", failed, len(fnames))
+	}
+
+	return results, err
+}
+
+func (fm *FunctionManager) RemoveFunctionDefinition(fname string) (oldFd FunctionDefinition, err error) {
+	groupName, err := fm.InstalledName(fname)
+	if err != nil {
+		return oldFd, err
 	}
 
 	oldFd = fm.Installed[groupName]
 	delete(fm.Installed, groupName)
+	fm.dirty = true
 
 	return oldFd, nil
 }
 
+// Finds the GroupName of an installed function given either its GroupName or
+// just its kind
+func (fm *FunctionManager) InstalledName(fname string) (string, error) {
+	group, name, _ := ToGroupNameVersion(fname)
+	if group != "" {
+		if _, ok := fm.Installed[group+"/"+name]; !ok {
+			return "", fmt.Errorf("function with name '%s' not installed", group+"/"+name)
+		}
+		return group + "/" + name, nil
+	}
+
+	var matches []string
+	for _, groupName := range fm.InstalledNames() {
+		if fm.Installed[groupName].Names.Kind == name {
+			matches = append(matches, groupName)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("function with name '%s' not installed", name)
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("more than one installed function named '%s': %s", name, strings.Join(matches, ", "))
+	}
+
+	return matches[0], nil
+}
+
 // returns a function with a single version
 func (fm *FunctionManager) GetCachedFunctionDefinition(fname string) (fn FunctionDefinition, err error) {
 	group, name, version := ToGroupNameVersion(fname)
@@ -166,125 +553,126 @@ func (fm *FunctionManager) GetCachedFunctionDefinition(fname string) (fn Functio
 		return fn, fmt.Errorf("cached function definition for '%s' has does not have exactly 1 version", fname)
 	}
 
-	if fn.Metadata == nil {
-		fn.Metadata = &v1.ObjectMeta{Annotations: map[string]string{}}
-	}
-
-	if version != "" {
-		if fn.Versions[0].Name != version {
-			return fn, fmt.Errorf("cached function definition for '%s' does not have version", version)
-		}
-		fn.Metadata.Annotations[IgnoreAutoUpdates] = "true"
-	} else {
-		fn.Metadata.Annotations[IgnoreAutoUpdates] = "false"
+	if version != "" && !MatchesVersion(fn.Versions[0].Name, version) {
+		return fn, fmt.Errorf("cached function definition for '%s' does not have version", version)
 	}
+	SetRequestedVersion(&fn, version)
 
 	return
 }
 
 // returns a function with a single version
 func (fm *FunctionManager) GetExternalFunctionDefinition(fname string) (fn FunctionDefinition, err error) {
-	_, _, version := ToGroupNameVersion(fname)
 	result, err := fm.CatMan.Search(fname, false)
 	if err != nil {
 		return
 	}
+
+	return fm.pickSearchResult(fname, result)
+}
+
+// Picks the single function a search term refers to. Functions whose name
+// matches exactly win over ones that only contain it, so Logger is not
+// ambiguous with FancyLogger.
+func (fm *FunctionManager) pickSearchResult(fname string, result []FunctionDefinition) (fn FunctionDefinition, err error) {
+	group, name, version := ToGroupNameVersion(fname)
 	if len(result) == 0 {
-		return fn, fmt.Errorf("no functions with name '%s'", fname)
-	}
-	if len(result) > 1 {
-		return fn, fmt.Errorf("more than one function found with search term '%s'", fname)
+		err = fmt.Errorf("no functions with name '%s'", fname)
+		if suggestions := fm.CatMan.Suggest(fname, 3); len(suggestions) > 0 {
+			err = fmt.Errorf("%v, did you mean: %s", err, strings.Join(suggestions, ", "))
+		}
+		return fn, err
 	}
 
-	fn = result[0]
-
-	if fn.Metadata == nil {
-		fn.Metadata = &v1.ObjectMeta{Annotations: map[string]string{}}
+	var exact []FunctionDefinition
+	for _, x := range result {
+		if x.Names.Kind == name && (group == "" || x.Group == group) {
+			exact = append(exact, x)
+		}
+	}
+	if len(exact) > 0 {
+		result = exact
 	}
 
-	var v FunctionVersion
+	if len(result) > 1 {
+		var candidates []string
+		for _, x := range result {
+			candidates = append(candidates, x.GroupName())
+		}
+		if fm.Picker == nil {
+			return fn, fmt.Errorf("more than one function found with search term '%s': %s", fname, strings.Join(candidates, ", "))
+		}
 
-	if version == "" {
-		v = fn.GetHighestVersion()
-		fn.Metadata.Annotations[IgnoreAutoUpdates] = "false"
-	} else {
-		v, err = result[0].GetVersion(version)
+		i, err := fm.Picker(fmt.Sprintf("More than one function matches '%s':", fname), candidates)
 		if err != nil {
-			return
+			return fn, err
 		}
-
-		fn.Metadata.Annotations[IgnoreAutoUpdates] = "true"
+		result = result[i : i+1]
 	}
 
-	fn.Versions = []FunctionVersion{v}
-
-	return
+	return SelectVersion(result[0], version)
 }
 
-func (fm *FunctionManager) UpdateFunctionDefinition(fname string) (oldFn FunctionDefinition, err error) {
-	oldFn, err = fm.RemoveFunctionDefinition(fname)
-	if err != nil {
-		return
-	}
-	if oldFn.Metadata.Annotations[IgnoreAutoUpdates] == "true" {
-		fm.Installed[oldFn.GroupName()] = oldFn
-		// return FunctionDefinition{}, fmt.Errorf("attempted to update function with pegged version. please remove the function in question first.")
-		return FunctionDefinition{}, nil
-	}
-
-	var newFn FunctionDefinition
-	newFn, err = fm.GetExternalFunctionDefinition(fname)
+func (fm *FunctionManager) SearchFunctionDefintions(q SearchQuery) (result FunctionList, err error) {
+	fds, err := fm.CatMan.Query(q)
 	if err != nil {
-		fm.Installed[oldFn.GroupName()] = oldFn
-		return
+		return result, err
 	}
 
-	fm.Installed[newFn.GroupName()] = newFn
-
-	return
+	return fm.MakeFunctionList(fds), nil
 }
 
-func (fm *FunctionManager) UpdateAllFunctionDefinitions() (oldFns []FunctionDefinition, errs []error) {
-	for fname, _ := range fm.Installed {
-		fd, err := fm.UpdateFunctionDefinition(fname)
-		oldFns = append(oldFns, fd)
-		errs = append(errs, err)
+func (fm *FunctionManager) ListFunctionDefinitions() FunctionList {
+	var fds []FunctionDefinition
+	for _, groupName := range fm.InstalledNames() {
+		fds = append(fds, fm.Installed[groupName])
 	}
 
-	return
+	return fm.MakeFunctionList(fds)
 }
 
-func (fm *FunctionManager) SearchFunctionDefintions(fname string) (result []byte, err error) {
-	fds, err := fm.CatMan.Search(fname, true)
-	if err != nil {
-		return nil, err
-	}
-	fc := MakeFunctionCatalog("Search results for '" + fname + "'")
-	fc.Spec.KrmFunctions = append(fc.Spec.KrmFunctions, fds...)
-	return yaml.Marshal(fc)
+// Sorted by GroupName
+func (fm *FunctionManager) InstalledNames() []string {
+	groupNames := maps.Keys(fm.Installed)
+	sort.Strings(groupNames)
+
+	return groupNames
 }
 
 func (fm *FunctionManager) GenerateInstalledCatalog() (result []byte, err error) {
 	fc := MakeFunctionCatalog("Kaffine Managed Functions")
-	for _, fn := range fm.Installed {
-		fc.Spec.KrmFunctions = append(fc.Spec.KrmFunctions, fn)
+	for _, groupName := range fm.InstalledNames() {
+		fc.Spec.KrmFunctions = append(fc.Spec.KrmFunctions, fm.Installed[groupName])
 	}
+
+	// Keep the previous timestamp unless the functions changed
+	if b, err := os.ReadFile(filepath.Join(fm.Directory, "installed.yaml")); err == nil {
+		var previous FunctionCatalog
+		if yaml.Unmarshal(b, &previous) == nil && previous.Metadata != nil && sameSpec(previous, fc) {
+			fc.Metadata.CreationTimestamp = previous.Metadata.CreationTimestamp
+		}
+	}
+
 	return yaml.Marshal(fc)
 }
 
+func sameSpec(a, b FunctionCatalog) bool {
+	x, errA := yaml.Marshal(a.Spec)
+	y, errB := yaml.Marshal(b.Spec)
+
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
+
 func (fm *FunctionManager) UpdateConfig() (err error) {
-	fm.Cfg.Catalogs = maps.Keys(fm.CatMan.Catalogs)
-
-	fm.Cfg.Dependencies.KrmFunctions = make([]string, 0)
-	for groupName, fd := range fm.Installed {
-		fname := groupName
-		if fd.Metadata != nil {
-			if val, ok := fd.Metadata.Annotations[IgnoreAutoUpdates]; ok && val == "true" {
-				fname = fname + "@" + fd.Versions[0].Name
-			}
-		}
-		fm.Cfg.Dependencies.KrmFunctions = append(fm.Cfg.Dependencies.KrmFunctions, fname)
+	catalogs := fm.CatMan.ConfiguredURIs()
+
+	krmFunctions := make([]string, 0)
+	for _, groupName := range fm.InstalledNames() {
+		krmFunctions = append(krmFunctions, Requirement(fm.Installed[groupName]))
 	}
 
+	fm.Cfg.SetCatalogs(catalogs)
+	fm.Cfg.SetKrmFunctions(krmFunctions)
+
 	return nil
 }
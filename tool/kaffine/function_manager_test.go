@@ -0,0 +1,349 @@
+package kaffine
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Sets up a kaffine directory with the given number of catalogs, each with
+// ten functions, and three functions from the first one installed
+func makeTestDirectory(t testing.TB, catalogs int) string {
+	dir := t.TempDir()
+
+	fm, err := NewFunctionManager(dir, ExclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	for i := 0; i < catalogs; i++ {
+		fc := MakeFunctionCatalog(fmt.Sprintf("catalog-%d", i))
+		for j := 0; j < 10; j++ {
+			fd := FunctionDefinition{Group: fmt.Sprintf("example%d.com", i), Description: "Does things"}
+			fd.Names.Kind = fmt.Sprintf("Function%d", j)
+			fd.Versions = []FunctionVersion{{Name: "v1.0.0"}}
+			fd.Versions[0].Runtime.Container.Image = "image:v1.0.0"
+			fc.Spec.KrmFunctions = append(fc.Spec.KrmFunctions, fd)
+		}
+
+		b, err := yaml.Marshal(fc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("catalog-%d.yaml", i))
+		if err = os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = fm.CatMan.AddCatalog("file://" + path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fnames := []string{"example0.com/Function0", "example0.com/Function1", "example0.com/Function2"}
+
+	if _, err = fm.AddFunctionDefinitions(fnames, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = fm.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestNewFunctionManagerIsLazy(t *testing.T) {
+	dir := makeTestDirectory(t, 3)
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	if fm.CatMan.Loaded() {
+		t.Error("catalogs loaded at startup")
+	}
+	if len(fm.Installed) != 3 || len(fm.CatMan.URIs) != 3 {
+		t.Errorf("got %d installed functions and %d catalogs, want 3 of each", len(fm.Installed), len(fm.CatMan.URIs))
+	}
+
+	if _, err = fm.CatMan.SearchExact("example1.com/Function5"); err != nil {
+		t.Error(err)
+	}
+	if !fm.CatMan.Loaded() {
+		t.Error("catalogs not loaded by a search")
+	}
+}
+
+// Startup reads the config and installed.json but no catalog, so it only grows
+// with the length of the catalog list in the config, not with the catalogs
+func BenchmarkNewFunctionManager(b *testing.B) {
+	for _, catalogs := range []int{1, 10, 100} {
+		dir := makeTestDirectory(b, catalogs)
+
+		b.Run(fmt.Sprintf("catalogs=%d", catalogs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fm, err := NewFunctionManager(dir, SharedLock)
+				if err != nil {
+					b.Fatal(err)
+				}
+				fm.Close()
+			}
+		})
+	}
+}
+
+// What a command that does need the catalogs pays on top of startup
+func BenchmarkLoadCatalogs(b *testing.B) {
+	for _, catalogs := range []int{1, 10, 100} {
+		dir := makeTestDirectory(b, catalogs)
+
+		b.Run(fmt.Sprintf("catalogs=%d", catalogs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fm, err := NewFunctionManager(dir, SharedLock)
+				if err != nil {
+					b.Fatal(err)
+				}
+				fm.CatMan.Load()
+				fm.Close()
+			}
+		})
+	}
+}
+
+func TestPickSearchResultPrefersExactNames(t *testing.T) {
+	var fns []FunctionDefinition
+	for _, groupName := range []string{"example.com/Logger", "example.com/FancyLogger", "other.com/Logger"} {
+		group, kind, _ := ToGroupNameVersion(groupName)
+		fd := FunctionDefinition{Group: group, Versions: []FunctionVersion{{Name: "v1.0.0"}}}
+		fd.Names.Kind = kind
+		fns = append(fns, fd)
+	}
+
+	var tests = []struct {
+		fname string
+		want  string
+	}{
+		{"example.com/Logger", "example.com/Logger"},
+		{"Logg", ""},
+		{"FancyLogger", "example.com/FancyLogger"},
+		{"other.com/Logger@v1.0.0", "other.com/Logger"},
+		// Two exact matches are still ambiguous
+		{"Logger", ""},
+	}
+
+	for _, test := range tests {
+		fm := makeDependencyManager(nil, fns...)
+		fn, err := fm.GetExternalFunctionDefinition(test.fname)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an ambiguous match, got %s", test.fname, fn.GroupName())
+			}
+			continue
+		}
+		if err != nil || fn.GroupName() != test.want {
+			t.Errorf("%s: got %s (%v), want %s", test.fname, fn.GroupName(), err, test.want)
+		}
+	}
+
+	fm := makeDependencyManager(nil, fns[0], fns[1])
+	if fn, err := fm.GetExternalFunctionDefinition("Logger"); err != nil || fn.GroupName() != "example.com/Logger" {
+		t.Errorf("Logger with FancyLogger: got %s (%v), want example.com/Logger", fn.GroupName(), err)
+	}
+}
+
+// A read-only command writes the index it had to rebuild, so the next one
+// does not parse every catalog again
+func TestSaveCachesWritesIndex(t *testing.T) {
+	dir := makeTestDirectory(t, 2)
+	indexPath := filepath.Join(dir, "search-index.json")
+	if err := os.Remove(indexPath); err != nil {
+		t.Fatal(err)
+	}
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.CatMan.Load()
+	if !fm.CatMan.Index.dirty {
+		t.Fatal("index not rebuilt")
+	}
+	if err = fm.SaveCaches(); err != nil {
+		t.Fatal(err)
+	}
+	fm.Close()
+
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+	fm, err = NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	fm.CatMan.Load()
+	if fm.CatMan.Index.dirty {
+		t.Error("index rebuilt again")
+	}
+}
+
+// Same for the installed functions resolved again from the config
+func TestSaveCachesWritesInstalledState(t *testing.T) {
+	dir := makeTestDirectory(t, 1)
+	if err := os.Remove(filepath.Join(dir, "installed.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fm.SaveCaches(); err != nil {
+		t.Fatal(err)
+	}
+	fm.Close()
+
+	fm, err = NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	if installed, ok := fm.readInstalledState(); !ok || len(installed) != 3 {
+		t.Errorf("installed.json not written, got %d functions", len(installed))
+	}
+	if fm.CatMan.Loaded() {
+		t.Error("catalogs loaded to resolve the installed functions again")
+	}
+}
+
+func TestAddAndRemoveSeveralFunctions(t *testing.T) {
+	var tests = []struct {
+		name      string
+		keepGoing bool
+		// Installed after adding Function3, Missing and Function4, and after
+		// removing Function0, Function3 and Function1
+		installed []string
+		left      []string
+	}{
+		{"all or nothing", false, []string{"Function0", "Function1", "Function2"}, []string{"Function0", "Function1", "Function2"}},
+		{"keep going", true, []string{"Function0", "Function1", "Function2", "Function3", "Function4"}, []string{"Function2", "Function4"}},
+	}
+
+	for _, test := range tests {
+		dir := makeTestDirectory(t, 1)
+		fm, err := NewFunctionManager(dir, ExclusiveLock)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := fm.AddFunctionDefinitions([]string{"example0.com/Function3", "example0.com/Missing", "example0.com/Function4"}, test.keepGoing)
+		if err == nil || len(results) != 3 || results[1].Action != "failed" {
+			t.Errorf("%s: expected only Missing to fail, got %v (%v)", test.name, results, err)
+		}
+		if got := installedKinds(fm); !reflect.DeepEqual(got, test.installed) {
+			t.Errorf("%s: installing left %v, want %v", test.name, got, test.installed)
+		}
+
+		// Function3 is only installed when going on
+		results, err = fm.RemoveFunctionDefinitions([]string{"example0.com/Function0", "example0.com/Function3", "example0.com/Function1"}, test.keepGoing, false)
+		if test.keepGoing != (err == nil) || len(results) != 3 {
+			t.Errorf("%s: removing got %v (%v)", test.name, results, err)
+		}
+		if got := installedKinds(fm); !reflect.DeepEqual(got, test.left) {
+			t.Errorf("%s: removing left %v, want %v", test.name, got, test.left)
+		}
+		fm.Close()
+	}
+}
+
+func installedKinds(fm *FunctionManager) (kinds []string) {
+	for _, groupName := range fm.InstalledNames() {
+		kinds = append(kinds, fm.Installed[groupName].Names.Kind)
+	}
+
+	return
+}
+
+// Every file under dir with its contents and when it was written
+func directoryContents(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		files[path] = info.ModTime().String() + "\n" + string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+// What list, search, info and outdated do, followed by what happens after any
+// read-only command
+func TestReadOnlyCommandsLeaveDirectoryAlone(t *testing.T) {
+	dir := makeTestDirectory(t, 2)
+	before := directoryContents(t, dir)
+
+	commands := map[string]func(fm *FunctionManager) error{
+		"list": func(fm *FunctionManager) error {
+			fm.ListFunctionDefinitions()
+			return nil
+		},
+		"search": func(fm *FunctionManager) error {
+			_, err := fm.SearchFunctionDefintions(SearchQuery{Name: "Function1"})
+			return err
+		},
+		"search --text": func(fm *FunctionManager) error {
+			_, err := fm.SearchFunctionDefintions(SearchQuery{Text: "things"})
+			return err
+		},
+		"info": func(fm *FunctionManager) error {
+			_, err := fm.Info("example1.com/Function0")
+			return err
+		},
+		"outdated": func(fm *FunctionManager) error {
+			latest, errs := fm.CatMan.FetchLatest(fm.CatMan.URIs)
+			fm.Outdated(latest)
+			return errs[fm.CatMan.URIs[0]]
+		},
+	}
+	for name, command := range commands {
+		fm, err := NewFunctionManager(dir, SharedLock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = command(fm); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err = fm.SaveCaches(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		fm.Close()
+
+		after := directoryContents(t, dir)
+		for path := range after {
+			if after[path] != before[path] {
+				t.Errorf("%s: wrote %s", name, path)
+			}
+		}
+		for path := range before {
+			if _, ok := after[path]; !ok {
+				t.Errorf("%s: removed %s", name, path)
+			}
+		}
+	}
+}
@@ -3,12 +3,15 @@ package kaffine
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	_ "embed"
 )
 
+const Version string = "0.0.0"
+
 var Directory string = ""
 
 //go:embed default_config.yaml
@@ -16,6 +19,24 @@ var DefaultConfig []byte
 
 var Fm *FunctionManager
 
+// Returned by commands that want a specific exit status, like `outdated
+// --exit-code`
+type ExitError struct {
+	Code int
+	Err  error
+	// Keep the changes the command made before failing, like the functions
+	// `install --keep-going` managed to install
+	Save bool
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
 // Helper functions
 func SHA1(s string) string {
 	a := sha1.New()
@@ -23,7 +44,14 @@ func SHA1(s string) string {
 	return hex.EncodeToString(a.Sum(nil))
 }
 
-func InitializeGlobals() (err error) {
+// Marks a command as read-only, so it takes a shared lock and never saves
+var ReadOnlyCommand string = "kaffine.config/read-only"
+
+// Marks a command that does not use the kaffine directory at all, so it runs
+// without one being created, locked or read
+var StandaloneCommand string = "kaffine.config/standalone"
+
+func InitializeGlobals(mode LockMode) (err error) {
 	// Directory
 	wd, err := os.Getwd()
 	if err != nil {
@@ -52,16 +80,29 @@ func InitializeGlobals() (err error) {
 		return err
 	}
 
-	Fm = NewFunctionManager(Directory)
+	Fm, err = NewFunctionManager(Directory, mode)
+	if err != nil {
+		return err
+	}
 
 	return
 }
 
 func DestroyGlobals() (err error) {
-	err = Fm.Save()
-	if err != nil {
+	if Fm == nil {
 		return
 	}
+	defer Fm.Close()
+
+	if Fm.lock.Mode == ExclusiveLock {
+		return Fm.Save()
+	}
+
+	// Only caches, so a read-only command still succeeds when they cannot
+	// be written
+	if err := Fm.SaveCaches(); err != nil {
+		fmt.Fprintf(Stderr, "warning: could not write caches: %v\n", err)
+	}
 
 	return
 }
@@ -0,0 +1,345 @@
+package kaffine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"sigs.k8s.io/yaml"
+)
+
+// A version change of one function. From is empty for installs, To for
+// removals.
+type HistoryFunctionChange struct {
+	Function string `json:"function"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+}
+
+type HistoryCatalog struct {
+	URI      string `json:"uri"`
+	Revision string `json:"revision"`
+	// Signing fingerprint the catalog was verified with, if it needed a
+	// signature
+	Verified string `json:"verified,omitempty"`
+}
+
+// One operation that changed the kaffine directory, and the state it left
+// behind. Revisions name files in history/objects/.
+type HistoryEntry struct {
+	ID        int                     `json:"id"`
+	Timestamp string                  `json:"timestamp"`
+	Operation string                  `json:"operation"`
+	Functions []HistoryFunctionChange `json:"functions,omitempty"`
+
+	Catalogs     []HistoryCatalog `json:"catalogs"`
+	KrmFunctions []string         `json:"krmFunctions"`
+	Installed    string           `json:"installed"`
+}
+
+type History struct {
+	Entries []HistoryEntry `json:"entries"`
+}
+
+func (fm *FunctionManager) historyDirectory() string {
+	return filepath.Join(fm.Directory, "history")
+}
+
+// Entries oldest first
+func (fm *FunctionManager) History() (h History, err error) {
+	h.Entries = []HistoryEntry{}
+
+	files, err := os.ReadDir(fm.historyDirectory())
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(fm.historyDirectory(), file.Name()))
+		if err != nil {
+			return h, err
+		}
+
+		var entry HistoryEntry
+		if err := yaml.Unmarshal(b, &entry); err != nil {
+			return h, fmt.Errorf("history entry '%s': %v", file.Name(), err)
+		}
+		h.Entries = append(h.Entries, entry)
+	}
+
+	sort.Slice(h.Entries, func(i, j int) bool {
+		return h.Entries[i].ID < h.Entries[j].ID
+	})
+
+	return h, nil
+}
+
+func (h History) Find(id int) (HistoryEntry, error) {
+	for _, entry := range h.Entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+
+	return HistoryEntry{}, fmt.Errorf("no history entry %d", id)
+}
+
+// Appends an entry for the current state. The first entry also records the
+// state kaffine started from, so there is always something to roll back to.
+func (fm *FunctionManager) recordHistory() error {
+	h, err := fm.History()
+	if err != nil {
+		return err
+	}
+
+	if len(h.Entries) == 0 {
+		fm.CatMan.Load()
+		initial, err := fm.makeHistoryEntry(1, "initial", fm.loaded, fm.CatMan.loadedURIs, fm.CatMan.loadedCatalogs, fm.loaded)
+		if err != nil {
+			return err
+		}
+		h.Entries = append(h.Entries, initial)
+		if err := fm.writeHistoryEntry(initial); err != nil {
+			return err
+		}
+	}
+
+	last := h.Entries[len(h.Entries)-1]
+	entry, err := fm.makeHistoryEntry(last.ID+1, fm.Operation, fm.loaded, fm.CatMan.URIs, fm.CatMan.Catalogs, fm.Installed)
+	if err != nil {
+		return err
+	}
+	// Catalogs that were never loaded are as the last entry left them
+	if !fm.CatMan.Loaded() {
+		entry.Catalogs = last.Catalogs
+	}
+
+	return fm.writeHistoryEntry(entry)
+}
+
+// Records catalogs in the order of uris, which for the initial entry is the
+// order they were loaded in
+func (fm *FunctionManager) makeHistoryEntry(id int, operation string, before map[string]FunctionDefinition, uris []string, catalogs map[string]FunctionCatalog, installed map[string]FunctionDefinition) (entry HistoryEntry, err error) {
+	entry = HistoryEntry{
+		ID:           id,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Operation:    operation,
+		Functions:    diffInstalled(before, installed),
+		Catalogs:     []HistoryCatalog{},
+		KrmFunctions: []string{},
+	}
+
+	for _, uri := range uris {
+		cat, ok := catalogs[uri]
+		if !ok {
+			continue
+		}
+		revision, err := fm.writeHistoryObject(cat)
+		if err != nil {
+			return entry, err
+		}
+		entry.Catalogs = append(entry.Catalogs, HistoryCatalog{URI: uri, Revision: revision, Verified: fm.CatMan.verifiedWith(uri)})
+	}
+
+	fc := MakeFunctionCatalog("Kaffine Managed Functions")
+	fc.Metadata.CreationTimestamp.Reset()
+	groupNames := maps.Keys(installed)
+	sort.Strings(groupNames)
+	for _, groupName := range groupNames {
+		fc.Spec.KrmFunctions = append(fc.Spec.KrmFunctions, installed[groupName])
+		entry.KrmFunctions = append(entry.KrmFunctions, Requirement(installed[groupName]))
+	}
+	entry.Installed, err = fm.writeHistoryObject(fc)
+
+	return entry, err
+}
+
+func diffInstalled(before, after map[string]FunctionDefinition) (changes []HistoryFunctionChange) {
+	groupNames := maps.Keys(before)
+	for groupName := range after {
+		if _, ok := before[groupName]; !ok {
+			groupNames = append(groupNames, groupName)
+		}
+	}
+	sort.Strings(groupNames)
+
+	for _, groupName := range groupNames {
+		change := HistoryFunctionChange{Function: groupName}
+		if fd, ok := before[groupName]; ok && len(fd.Versions) > 0 {
+			change.From = fd.Versions[0].Name
+		}
+		if fd, ok := after[groupName]; ok && len(fd.Versions) > 0 {
+			change.To = fd.Versions[0].Name
+		}
+		if change.From != change.To {
+			changes = append(changes, change)
+		}
+	}
+
+	return
+}
+
+func (fm *FunctionManager) writeHistoryEntry(entry HistoryEntry) error {
+	b, err := yaml.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(fm.historyDirectory(), fmt.Sprintf("%06d.yaml", entry.ID))
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("history entry %d already exists", entry.ID)
+	}
+
+	return writeFileAtomic(path, b)
+}
+
+// Stores v by the hash of its contents and returns the hash
+func (fm *FunctionManager) writeHistoryObject(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	revision := SHA1(string(b))
+	path := filepath.Join(fm.historyDirectory(), "objects", revision+".yaml")
+	if _, err := os.Stat(path); err == nil {
+		return revision, nil
+	}
+
+	return revision, writeFileAtomic(path, b)
+}
+
+func (fm *FunctionManager) readHistoryObject(revision string, v interface{}) error {
+	b, err := os.ReadFile(filepath.Join(fm.historyDirectory(), "objects", revision+".yaml"))
+	if err != nil {
+		return fmt.Errorf("history object '%s' is missing: %v", revision, err)
+	}
+
+	return yaml.Unmarshal(b, v)
+}
+
+// The entry `kaffine rollback` goes back to without an id: the one before the
+// state the directory is in. After a rollback that state is the entry rolled
+// back to, so rolling back again keeps going back instead of reapplying what
+// the rollback undid.
+func (h History) DefaultRollback() (int, error) {
+	if len(h.Entries) == 0 {
+		return 0, errors.New("nothing to roll back")
+	}
+
+	current := h.Entries[len(h.Entries)-1]
+	for {
+		id, err := strconv.Atoi(strings.TrimPrefix(current.Operation, "rollback "))
+		if err != nil || !strings.HasPrefix(current.Operation, "rollback ") {
+			break
+		}
+		if current, err = h.Find(id); err != nil {
+			return 0, err
+		}
+	}
+
+	for i := len(h.Entries) - 1; i >= 0; i-- {
+		if h.Entries[i].ID < current.ID {
+			return h.Entries[i].ID, nil
+		}
+	}
+
+	return 0, errors.New("nothing to roll back")
+}
+
+// Restores the installed functions, the config dependencies and the catalog
+// cache recorded in entry id. Catalogs that need a signature are only
+// restored if they were verified with their current public keys, so the cache
+// still vouches for them. The rollback itself becomes a new entry when saved.
+func (fm *FunctionManager) Rollback(id int) (entry HistoryEntry, err error) {
+	h, err := fm.History()
+	if err != nil {
+		return
+	}
+	if entry, err = h.Find(id); err != nil {
+		return
+	}
+
+	catman := &CatalogManager{
+		Directory: fm.CatMan.Directory,
+		Catalogs:  map[string]FunctionCatalog{},
+		Functions: map[string]FunctionDefinition{},
+		loaded:    true,
+	}
+	verified := &sync.Map{}
+	for _, c := range entry.Catalogs {
+		if fingerprint := fm.CatMan.signingFingerprint(c.URI); fingerprint != "" {
+			if c.Verified != fingerprint {
+				return entry, fmt.Errorf("cannot roll back to %d: catalog '%s' was not verified with its current public keys then", id, c.URI)
+			}
+			verified.Store(c.URI, fingerprint)
+		}
+
+		var cat FunctionCatalog
+		if err = fm.readHistoryObject(c.Revision, &cat); err != nil {
+			return
+		}
+		if err = catman.insertCatalog(c.URI, cat); err != nil {
+			return
+		}
+	}
+
+	var fc FunctionCatalog
+	if err = fm.readHistoryObject(entry.Installed, &fc); err != nil {
+		return
+	}
+	installed := map[string]FunctionDefinition{}
+	for _, fd := range fc.Spec.KrmFunctions {
+		installed[fd.GroupName()] = fd
+	}
+
+	fm.CatMan.swapCatalogs(catman)
+	fm.CatMan.dirty = true
+	fm.CatMan.verified = verified
+	fm.Installed = installed
+	fm.dirty = true
+	fm.Operation = "rollback " + strconv.Itoa(id)
+
+	return entry, nil
+}
+
+func (h History) Header() []string {
+	return []string{"ID", "TIME", "OPERATION", "CHANGES"}
+}
+
+func (h History) Rows() (rows [][]string) {
+	for _, entry := range h.Entries {
+		var changes []string
+		for _, change := range entry.Functions {
+			changes = append(changes, change.String())
+		}
+		rows = append(rows, []string{strconv.Itoa(entry.ID), entry.Timestamp, entry.Operation, strings.Join(changes, ", ")})
+	}
+
+	return
+}
+
+func (change HistoryFunctionChange) String() string {
+	switch {
+	case change.From == "":
+		return fmt.Sprintf("+%s@%s", change.Function, change.To)
+	case change.To == "":
+		return fmt.Sprintf("-%s@%s", change.Function, change.From)
+	}
+
+	return fmt.Sprintf("%s %s->%s", change.Function, change.From, change.To)
+}
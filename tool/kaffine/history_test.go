@@ -0,0 +1,277 @@
+package kaffine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Writes a catalog with a single example.com/Logger at version
+func writeHistoryCatalog(t *testing.T, path string, version string) {
+	fd := FunctionDefinition{Group: "example.com"}
+	fd.Names.Kind = "Logger"
+	fd.Versions = []FunctionVersion{{Name: version}}
+	fd.Versions[0].Runtime.Container.Image = "logger:" + version
+	writeCatalog(t, path, fd)
+}
+
+// Writes a catalog with fns
+func writeCatalog(t *testing.T, path string, fns ...FunctionDefinition) {
+	fc := MakeFunctionCatalog("history")
+	fc.Spec.KrmFunctions = fns
+
+	b, err := yaml.Marshal(fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Runs f with the exclusive lock and saves, like a mutating command
+func runHistoryCommand(t *testing.T, dir string, operation string, f func(fm *FunctionManager) error) {
+	fm, err := NewFunctionManager(dir, ExclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	fm.Operation = operation
+	if err = f(fm); err != nil {
+		t.Fatalf("%s: %v", operation, err)
+	}
+	if err = fm.Save(); err != nil {
+		t.Fatalf("%s: %v", operation, err)
+	}
+}
+
+// The installed version, the dependencies in the config and the version in
+// the cached catalog
+func historyState(t *testing.T, dir string, uri string) (installed string, krmFunctions []string, cached string) {
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	if fd, ok := fm.Installed["example.com/Logger"]; ok {
+		installed = fd.Versions[0].Name
+	}
+	if fc, err := fm.CatMan.GetCachedCatalog(uri); err == nil {
+		cached = fc.Spec.KrmFunctions[0].Versions[0].Name
+	}
+
+	return installed, fm.Cfg.Dependencies.KrmFunctions, cached
+}
+
+func TestRollbackUpdate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + path
+	writeHistoryCatalog(t, path, "v1.0.0")
+
+	runHistoryCommand(t, dir, "config add-catalog", func(fm *FunctionManager) error {
+		return fm.CatMan.AddCatalog(uri)
+	})
+	runHistoryCommand(t, dir, "install", func(fm *FunctionManager) error {
+		_, err := fm.AddFunctionDefinitions([]string{"example.com/Logger"}, false)
+		return err
+	})
+
+	writeHistoryCatalog(t, path, "v2.0.0")
+	runHistoryCommand(t, dir, "update", func(fm *FunctionManager) error {
+		plan, err := fm.PlanUpdate(UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		return fm.ApplyPlan(plan)
+	})
+	if installed, _, cached := historyState(t, dir, uri); installed != "v2.0.0" || cached != "v2.0.0" {
+		t.Fatalf("update: got %s installed and %s cached, want v2.0.0", installed, cached)
+	}
+
+	var target int
+	runHistoryCommand(t, dir, "rollback", func(fm *FunctionManager) (err error) {
+		h, err := fm.History()
+		if err != nil {
+			return err
+		}
+		if target, err = h.DefaultRollback(); err != nil {
+			return err
+		}
+		_, err = fm.Rollback(target)
+		return err
+	})
+
+	installed, krmFunctions, cached := historyState(t, dir, uri)
+	if installed != "v1.0.0" || cached != "v1.0.0" {
+		t.Errorf("rollback %d: got %s installed and %s cached, want v1.0.0", target, installed, cached)
+	}
+	if !reflect.DeepEqual(krmFunctions, []string{"example.com/Logger"}) {
+		t.Errorf("rollback %d: got krmFunctions %v", target, krmFunctions)
+	}
+
+	// Going on goes further back instead of undoing the rollback
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	h, err := fm.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, err := h.DefaultRollback(); err != nil || next >= target {
+		t.Errorf("second rollback: got entry %d (%v), want one before %d", next, err, target)
+	}
+}
+
+func TestRollbackRestoresRemovedCatalog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + path
+	writeHistoryCatalog(t, path, "v1.0.0")
+
+	runHistoryCommand(t, dir, "config add-catalog", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog(uri); err != nil {
+			return err
+		}
+		_, err := fm.AddFunctionDefinitions([]string{"example.com/Logger"}, false)
+		return err
+	})
+	// As if the directory was set up before the history was kept, so the
+	// removal is the first recorded command
+	if err := os.RemoveAll(filepath.Join(dir, "history")); err != nil {
+		t.Fatal(err)
+	}
+
+	runHistoryCommand(t, dir, "config remove-catalog", func(fm *FunctionManager) error {
+		_, err := fm.CatMan.RemoveCatalog(uri)
+		return err
+	})
+	if _, _, cached := historyState(t, dir, uri); cached != "" {
+		t.Fatalf("catalog still cached after removal")
+	}
+
+	runHistoryCommand(t, dir, "rollback", func(fm *FunctionManager) error {
+		_, err := fm.Rollback(1)
+		return err
+	})
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	if !reflect.DeepEqual(fm.CatMan.URIs, []string{uri}) {
+		t.Errorf("got catalogs %v, want %s", fm.CatMan.URIs, uri)
+	}
+	if fc, err := fm.CatMan.GetCachedCatalog(uri); err != nil || len(fc.Spec.KrmFunctions) != 1 {
+		t.Errorf("catalog not restored to the cache: %v", err)
+	}
+}
+
+func TestDefaultRollback(t *testing.T) {
+	entries := func(operations ...string) History {
+		var h History
+		for i, op := range operations {
+			h.Entries = append(h.Entries, HistoryEntry{ID: i + 1, Operation: op})
+		}
+		return h
+	}
+
+	var tests = []struct {
+		history History
+		want    int
+	}{
+		{entries("initial", "install", "update"), 2},
+		{entries("initial", "install", "update", "rollback 2"), 1},
+		{entries("initial", "install", "update", "rollback 2", "install"), 4},
+		{entries("initial", "install", "update", "rollback 2", "rollback 1"), 0},
+		{entries("initial"), 0},
+	}
+
+	for _, test := range tests {
+		got, err := test.history.DefaultRollback()
+		if (err != nil) != (test.want == 0) || got != test.want {
+			t.Errorf("%v: got %d (%v), want %d", test.history.Entries, got, err, test.want)
+		}
+	}
+}
+
+// Signs the catalog at path with private
+func signHistoryCatalog(t *testing.T, path string, private []byte) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := SignCatalog(data, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path+SignatureSuffix, sig, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackSignedCatalog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + path
+	keyPath := filepath.Join(dir, "key.pub")
+	private, public := generateTestKey(t, "ed25519")
+	os.WriteFile(keyPath, public, 0644)
+
+	config, err := yaml.Marshal(map[string]interface{}{
+		"catalogOptions": map[string]CatalogOptions{uri: {PublicKeys: []string{keyPath}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "config.yaml"), config, 0644)
+
+	writeHistoryCatalog(t, path, "v1.0.0")
+	signHistoryCatalog(t, path, private)
+	runHistoryCommand(t, dir, "install", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog(uri); err != nil {
+			return err
+		}
+		_, err := fm.AddFunctionDefinitions([]string{"example.com/Logger"}, false)
+		return err
+	})
+
+	writeHistoryCatalog(t, path, "v2.0.0")
+	signHistoryCatalog(t, path, private)
+	runHistoryCommand(t, dir, "update", func(fm *FunctionManager) error {
+		plan, err := fm.PlanUpdate(UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		return fm.ApplyPlan(plan)
+	})
+
+	runHistoryCommand(t, dir, "rollback", func(fm *FunctionManager) error {
+		_, err := fm.Rollback(2)
+		return err
+	})
+	// Reloading uses the restored catalog instead of fetching v2.0.0 again
+	if installed, _, cached := historyState(t, dir, uri); installed != "v1.0.0" || cached != "v1.0.0" {
+		t.Errorf("got %s installed and %s cached after reloading, want v1.0.0", installed, cached)
+	}
+
+	// With other public keys the recorded verification no longer counts
+	_, other := generateTestKey(t, "ed25519")
+	os.WriteFile(keyPath, other, 0644)
+	fm, err := NewFunctionManager(dir, ExclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	if _, err = fm.Rollback(2); err == nil {
+		t.Error("rolled back to a catalog verified with other public keys")
+	}
+}
@@ -0,0 +1,231 @@
+package kaffine
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// How kaffine talks to servers, from the http section of the config
+type HTTPOptions struct {
+	// Limit for opening the connection, including the TLS handshake
+	ConnectTimeout time.Duration
+	// Longest the server may go without sending anything
+	ReadTimeout time.Duration
+	// Used instead of HTTP_PROXY and HTTPS_PROXY when set
+	Proxy string
+	// PEM files with certificates to trust on top of the system ones
+	CAFiles []string
+}
+
+var DefaultHTTPOptions = HTTPOptions{
+	ConnectTimeout: 10 * time.Second,
+	ReadTimeout:    15 * time.Second,
+}
+
+// The http section of the config, with defaults for what it leaves out
+func (c *Config) HTTPOptions() (opts HTTPOptions, err error) {
+	opts = DefaultHTTPOptions
+
+	if c.HTTP.ConnectTimeout != "" {
+		if opts.ConnectTimeout, err = time.ParseDuration(c.HTTP.ConnectTimeout); err != nil {
+			return opts, fmt.Errorf("http.connectTimeout: %v", err)
+		}
+	}
+	if c.HTTP.ReadTimeout != "" {
+		if opts.ReadTimeout, err = time.ParseDuration(c.HTTP.ReadTimeout); err != nil {
+			return opts, fmt.Errorf("http.readTimeout: %v", err)
+		}
+	}
+	if c.HTTP.Proxy != "" {
+		if _, err = url.Parse(c.HTTP.Proxy); err != nil {
+			return opts, fmt.Errorf("http.proxy: %v", err)
+		}
+		opts.Proxy = c.HTTP.Proxy
+	}
+	opts.CAFiles = c.HTTP.CAFiles
+
+	for uri, catalog := range c.CatalogOptions {
+		if _, err = url.Parse(catalog.Proxy); err != nil {
+			return opts, fmt.Errorf("catalogOptions '%s' proxy: %v", uri, err)
+		}
+	}
+
+	return opts, nil
+}
+
+// A non-2xx response
+type HTTPStatusError struct {
+	URI        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URI, e.Status)
+}
+
+// Server errors and rate limiting may go away, anything else will not
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Downloads things over http(s) for the catalogs, and anything else kaffine
+// fetches, with timeouts and retries
+type HTTPClient struct {
+	// Limit for a single attempt, including reading the body
+	Timeout time.Duration
+	// Longest the server may go without sending anything
+	ReadTimeout time.Duration
+	// Attempts after the first one fails
+	Retries int
+	// Wait before the first retry, doubled before each one after
+	Backoff time.Duration
+
+	client *http.Client
+}
+
+type proxyKey struct{}
+
+func NewHTTPClient(opts HTTPOptions, fetch FetchOptions) (*HTTPClient, error) {
+	var defaultProxy *url.URL
+	if opts.Proxy != "" {
+		var err error
+		if defaultProxy, err = url.Parse(opts.Proxy); err != nil {
+			return nil, fmt.Errorf("proxy: %v", err)
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if len(opts.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range opts.CAFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("CA bundle: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA bundle '%s' contains no certificates", file)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout}
+	transport := &http.Transport{
+		// A proxy given with the request wins over the configured one, which
+		// wins over the environment
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if proxy, ok := req.Context().Value(proxyKey{}).(string); ok && proxy != "" {
+				return url.Parse(proxy)
+			}
+			if defaultProxy != nil {
+				return defaultProxy, nil
+			}
+			return http.ProxyFromEnvironment(req)
+		},
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		TLSClientConfig:       tlsConfig,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &HTTPClient{
+		Timeout:     fetch.Timeout,
+		ReadTimeout: opts.ReadTimeout,
+		Retries:     fetch.Retries,
+		Backoff:     fetch.Backoff,
+		client:      &http.Client{Transport: transport},
+	}, nil
+}
+
+// Downloads uri, through proxy if it is not empty. Failed transfers, server
+// errors and rate limiting are tried again with backoff.
+func (c *HTTPClient) Get(uri string, proxy string) (data []byte, err error) {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		data, err = c.get(uri, proxy)
+
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) && !statusErr.Temporary() {
+			return data, err
+		}
+		if err == nil || attempt >= c.Retries {
+			return data, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// A single attempt
+func (c *HTTPClient) get(uri string, proxy string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), proxyKey{}, proxy))
+	defer cancel()
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "kaffine/"+Version)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HTTPStatusError{URI: uri, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var body io.Reader = resp.Body
+	if c.ReadTimeout > 0 {
+		timer := time.AfterFunc(c.ReadTimeout, cancel)
+		defer timer.Stop()
+		body = &idleTimeoutReader{r: resp.Body, timer: timer, timeout: c.ReadTimeout}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return nil, fmt.Errorf("GET %s: server sent nothing for %v", uri, c.ReadTimeout)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("GET %s: %v", uri, ctx.Err())
+	}
+
+	return data, err
+}
+
+// Cancels the request when the server goes quiet for longer than timeout
+type idleTimeoutReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.timer.Reset(r.timeout)
+
+	return n, err
+}
@@ -0,0 +1,115 @@
+package kaffine
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientGet(t *testing.T) {
+	var requests int32
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		userAgent.Store(r.UserAgent())
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(DefaultHTTPOptions, FetchOptions{Retries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		path     string
+		ok       bool
+		requests int32
+	}{
+		{"/", true, 1},
+		{"/missing", false, 1},
+		{"/unavailable", false, 3},
+	}
+
+	for _, test := range tests {
+		atomic.StoreInt32(&requests, 0)
+		data, err := client.Get(server.URL+test.path, "")
+		if test.ok && (err != nil || string(data) != "ok") {
+			t.Errorf("%s: got %q, %v", test.path, data, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected error", test.path)
+		}
+		if n := atomic.LoadInt32(&requests); n != test.requests {
+			t.Errorf("%s: %d requests, want %d", test.path, n, test.requests)
+		}
+		if ua := userAgent.Load(); ua != "kaffine/"+Version {
+			t.Errorf("%s: user agent %v", test.path, ua)
+		}
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		fmt.Fprint(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(DefaultHTTPOptions, FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := client.Get("http://catalogs.invalid/catalog.yaml", proxy.URL)
+	if err != nil || string(data) != "proxied" || proxied != 1 {
+		t.Errorf("got %q, %v after %d proxied requests", data, err, proxied)
+	}
+}
+
+func TestHTTPClientCAFiles(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(DefaultHTTPOptions, FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Get(server.URL, ""); err == nil {
+		t.Error("expected an untrusted certificate to fail")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	os.WriteFile(caFile, caPEM, 0644)
+
+	opts := DefaultHTTPOptions
+	opts.CAFiles = []string{caFile}
+	if client, err = NewHTTPClient(opts, FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := client.Get(server.URL, ""); err != nil || string(data) != "ok" {
+		t.Errorf("got %q, %v", data, err)
+	}
+
+	opts.CAFiles = []string{filepath.Join(t.TempDir(), "missing.pem")}
+	if _, err = NewHTTPClient(opts, FetchOptions{}); err == nil {
+		t.Error("expected error for a missing CA file")
+	}
+}
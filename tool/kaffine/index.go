@@ -0,0 +1,216 @@
+package kaffine
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/exp/maps"
+)
+
+// How much a word counts for, depending on where in a function it appears
+const (
+	kindWeight        = 20
+	tagWeight         = 15
+	descriptionWeight = 10
+	groupWeight       = 5
+	usageWeight       = 5
+)
+
+// Inverted index over the names, descriptions, tags and usage of the functions
+// in every catalog, kept per catalog so that adding, updating or removing one
+// only reindexes that catalog
+type SearchIndex struct {
+	FilePath string                    `json:"-"`
+	Catalogs map[string]IndexedCatalog `json:"catalogs"`
+
+	dirty bool
+}
+
+type IndexedCatalog struct {
+	// Token -> group/name -> weight
+	Postings map[string]map[string]int `json:"postings"`
+
+	// Sorted tokens, for prefix lookups
+	tokens []string
+	// Every function in the catalog, to find it without parsing the catalog
+	functions []string
+}
+
+type indexedField struct {
+	text   string
+	weight int
+}
+
+// Loads the index from filePath, starting empty if it is missing or unreadable
+func MakeSearchIndex(filePath string) SearchIndex {
+	index := SearchIndex{FilePath: filePath, Catalogs: map[string]IndexedCatalog{}}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return index
+	}
+	if err = json.Unmarshal(data, &index); err != nil || index.Catalogs == nil {
+		index.Catalogs = map[string]IndexedCatalog{}
+		index.dirty = true
+		return index
+	}
+	for uri, ic := range index.Catalogs {
+		ic.prepare()
+		index.Catalogs[uri] = ic
+	}
+
+	return index
+}
+
+// Fills in what is derived from the postings
+func (ic *IndexedCatalog) prepare() {
+	ic.tokens = maps.Keys(ic.Postings)
+	sort.Strings(ic.tokens)
+
+	functions := map[string]bool{}
+	for _, postings := range ic.Postings {
+		for groupName := range postings {
+			functions[groupName] = true
+		}
+	}
+	ic.functions = maps.Keys(functions)
+	sort.Strings(ic.functions)
+}
+
+func (index *SearchIndex) Has(uri string) bool {
+	_, ok := index.Catalogs[uri]
+	return ok
+}
+
+// Indexes the catalog, replacing what was indexed for uri before
+func (index *SearchIndex) Add(uri string, fc FunctionCatalog) {
+	ic := IndexedCatalog{Postings: map[string]map[string]int{}}
+	for _, fn := range fc.Spec.KrmFunctions {
+		var usage []string
+		for _, v := range fn.Versions {
+			usage = append(usage, v.Usage)
+		}
+		fields := []indexedField{
+			{fn.Names.Kind, kindWeight},
+			{strings.Join(fn.Tags, " "), tagWeight},
+			{fn.Description, descriptionWeight},
+			{fn.Group, groupWeight},
+			{strings.Join(usage, " "), usageWeight},
+		}
+
+		for _, field := range fields {
+			for _, token := range tokenize(field.text) {
+				if ic.Postings[token] == nil {
+					ic.Postings[token] = map[string]int{}
+				}
+				ic.Postings[token][fn.GroupName()] += field.weight
+			}
+		}
+	}
+	ic.prepare()
+
+	index.Catalogs[uri] = ic
+	index.dirty = true
+}
+
+func (index *SearchIndex) Remove(uri string) {
+	if !index.Has(uri) {
+		return
+	}
+
+	delete(index.Catalogs, uri)
+	index.dirty = true
+}
+
+// Drops the catalogs that are not in uris
+func (index *SearchIndex) Retain(uris []string) {
+	keep := map[string]bool{}
+	for _, uri := range uris {
+		keep[uri] = true
+	}
+
+	for uri := range index.Catalogs {
+		if !keep[uri] {
+			index.Remove(uri)
+		}
+	}
+}
+
+// Functions containing every word, as a token or the start of one, with
+// their relevance
+func (index *SearchIndex) Lookup(text string) map[string]int {
+	words := tokenize(text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var scores map[string]int
+	for _, word := range words {
+		wordScores := map[string]int{}
+		for _, ic := range index.Catalogs {
+			for i := sort.SearchStrings(ic.tokens, word); i < len(ic.tokens) && strings.HasPrefix(ic.tokens[i], word); i++ {
+				for groupName, weight := range ic.Postings[ic.tokens[i]] {
+					// A word that is the start of several tokens counts once
+					if weight > wordScores[groupName] {
+						wordScores[groupName] = weight
+					}
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for groupName := range scores {
+			if weight, ok := wordScores[groupName]; ok {
+				scores[groupName] += weight
+			} else {
+				delete(scores, groupName)
+			}
+		}
+	}
+
+	return scores
+}
+
+func (index *SearchIndex) Marshal() ([]byte, error) {
+	return json.Marshal(index)
+}
+
+// Lowercase words in text. CamelCase words are also split into their parts,
+// so FancyLogger can be found by logger.
+func tokenize(text string) (tokens []string) {
+	seen := map[string]bool{}
+	add := func(token string) {
+		token = strings.ToLower(token)
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		add(word)
+
+		runes := []rune(word)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			if unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1]) {
+				add(string(runes[start:i]))
+				start = i
+			}
+		}
+		if start > 0 {
+			add(string(runes[start:]))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,79 @@
+package kaffine
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestTokenize(t *testing.T) {
+	var tests = []struct {
+		text   string
+		tokens []string
+	}{
+		{"", nil},
+		{"FancyLogger", []string{"fancylogger", "fancy", "logger"}},
+		{"adds logging, and more logging!", []string{"adds", "logging", "and", "more"}},
+		{"example.com", []string{"example", "com"}},
+	}
+
+	for _, test := range tests {
+		if tokens := tokenize(test.text); !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("tokenize(%q) = %v, want %v", test.text, tokens, test.tokens)
+		}
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	var fc FunctionCatalog
+	if err := yaml.Unmarshal([]byte(testQueryCatalog), &fc); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "search-index.json")
+	index := MakeSearchIndex(path)
+	index.Add("a", fc)
+
+	var tests = []struct {
+		text    string
+		results []string
+	}{
+		{"logger", []string{"example.com/FancyLogger", "example.com/Logger"}},
+		{"log", []string{"example.com/FancyLogger", "example.com/Logger"}},
+		{"fancy lines", []string{"example.com/FancyLogger"}},
+		{"sidecars", []string{"example.com/Logger"}},
+		{"ogger", nil},
+	}
+
+	check := func(index SearchIndex) {
+		for _, test := range tests {
+			scores := index.Lookup(test.text)
+			if len(scores) != len(test.results) {
+				t.Errorf("%s: got %v, want %v", test.text, scores, test.results)
+			}
+			for _, groupName := range test.results {
+				if _, ok := scores[groupName]; !ok {
+					t.Errorf("%s: %s missing from %v", test.text, groupName, scores)
+				}
+			}
+		}
+	}
+	check(index)
+
+	// Survives a round trip through the file
+	b, err := index.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFileAtomic(path, b); err != nil {
+		t.Fatal(err)
+	}
+	check(MakeSearchIndex(path))
+
+	index.Remove("a")
+	if scores := index.Lookup("logger"); len(scores) != 0 {
+		t.Errorf("removed catalog still indexed: %v", scores)
+	}
+}
@@ -0,0 +1,150 @@
+package kaffine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Everything known about a single function, for `kaffine info`
+type FunctionInfo struct {
+	Function    string       `json:"function"`
+	Description string       `json:"description"`
+	Publisher   string       `json:"publisher"`
+	Home        string       `json:"home,omitempty"`
+	Maintainers []string     `json:"maintainers,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Catalog     string       `json:"catalog,omitempty"`
+	Deprecated  *Deprecation `json:"deprecated,omitempty"`
+	Yanked      bool         `json:"yanked,omitempty"`
+
+	Installed        bool   `json:"installed"`
+	InstalledVersion string `json:"installedVersion,omitempty"`
+	Pinned           bool   `json:"pinned"`
+
+	Versions []FunctionVersionInfo `json:"versions"`
+}
+
+type FunctionVersionInfo struct {
+	FunctionVersion
+	Installed bool `json:"installed"`
+}
+
+// Combines the catalog definition with the installed state. Functions that
+// are installed but no longer in any catalog only show the installed version.
+func (fm *FunctionManager) Info(fname string) (info FunctionInfo, err error) {
+	fd, err := fm.CatMan.SearchExact(fname)
+	if err != nil {
+		group, name, _ := ToGroupNameVersion(fname)
+		var ok bool
+		if fd, ok = fm.Installed[group+"/"+name]; !ok {
+			return info, err
+		}
+	}
+	installed, isInstalled := fm.Installed[fd.GroupName()]
+
+	info = FunctionInfo{
+		Function:    fd.GroupName(),
+		Description: fd.Description,
+		Publisher:   fd.Publisher,
+		Home:        fd.Home,
+		Maintainers: fd.Maintainers,
+		Tags:        fd.Tags,
+		Catalog:     fm.CatMan.Source(fd.GroupName()),
+		Deprecated:  fd.Deprecated,
+		Yanked:      fd.Yanked,
+		Installed:   isInstalled,
+	}
+	if isInstalled {
+		info.InstalledVersion = installed.Versions[0].Name
+		info.Pinned = IsPinned(installed)
+	}
+
+	for _, v := range fd.Versions {
+		info.Versions = append(info.Versions, FunctionVersionInfo{
+			FunctionVersion: v,
+			Installed:       isInstalled && v.Name == info.InstalledVersion,
+		})
+	}
+
+	return info, nil
+}
+
+func (info FunctionInfo) Describe(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Function:\t%s\n", info.Function)
+	fmt.Fprintf(tw, "Description:\t%s\n", info.Description)
+	fmt.Fprintf(tw, "Publisher:\t%s\n", info.Publisher)
+	fmt.Fprintf(tw, "Home:\t%s\n", info.Home)
+	fmt.Fprintf(tw, "Maintainers:\t%s\n", strings.Join(info.Maintainers, ", "))
+	fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(info.Tags, ", "))
+	fmt.Fprintf(tw, "Catalog:\t%s\n", info.Catalog)
+	if info.Deprecated != nil {
+		fmt.Fprintf(tw, "Status:\t%s\n", info.Deprecated)
+	}
+	if info.Yanked {
+		fmt.Fprintf(tw, "Status:\tyanked\n")
+	}
+
+	installed := "no"
+	if info.Installed {
+		installed = info.InstalledVersion
+		if info.Pinned {
+			installed += " (pinned)"
+		}
+	}
+	fmt.Fprintf(tw, "Installed:\t%s\n", installed)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nVersions:")
+	for _, v := range info.Versions {
+		name := v.Name
+		if v.Installed {
+			name += " (installed)"
+		}
+		fmt.Fprintf(w, "  %s\n", name)
+
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		if v.Runtime.Container.Image != "" {
+			fmt.Fprintf(tw, "    Image:\t%s\n", v.Runtime.Container.Image)
+			if v.Runtime.Container.Sha256 != "" {
+				fmt.Fprintf(tw, "    Sha256:\t%s\n", v.Runtime.Container.Sha256)
+			}
+			if v.Runtime.Container.RequireNetwork {
+				fmt.Fprintf(tw, "    Network:\trequired\n")
+			}
+			if v.Runtime.Container.RequireStorageMount {
+				fmt.Fprintf(tw, "    Storage mount:\trequired\n")
+			}
+		}
+		for _, p := range v.Runtime.Exec.Platforms {
+			fmt.Fprintf(tw, "    Exec:\t%s/%s %s (%s)\n", p.Os, p.Arch, p.Uri, p.Sha256)
+		}
+		fmt.Fprintf(tw, "    License:\t%s\n", v.License)
+		if v.Deprecated != nil {
+			fmt.Fprintf(tw, "    Status:\t%s\n", v.Deprecated)
+		}
+		if v.Yanked {
+			fmt.Fprintf(tw, "    Status:\tyanked\n")
+		}
+		fmt.Fprintf(tw, "    Idempotent:\t%t\n", v.Idempotent)
+		if v.Usage != "" {
+			fmt.Fprintf(tw, "    Usage:\t%s\n", v.Usage)
+		}
+		for i, example := range v.Examples {
+			label := ""
+			if i == 0 {
+				label = "Examples:"
+			}
+			fmt.Fprintf(tw, "    %s\t%s\n", label, example)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package kaffine
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + path
+	logger := makeImageFunction(map[string]string{"v1.0.0": "logger:1.0", "v1.1.0": "logger:1.1", "v2.0.0": "logger:2.0"})
+	base := makeDependencyFunction("Base", map[string][]FunctionDependency{"v1.0.0": nil})
+	other := makeDependencyFunction("Other", map[string][]FunctionDependency{"v1.0.0": nil})
+	writeCatalog(t, path, logger, base, other)
+
+	runHistoryCommand(t, dir, "install", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog(uri); err != nil {
+			return err
+		}
+		_, err := fm.AddFunctionDefinitions([]string{"example.com/Logger@v1.1.0", "example.com/Other"}, false)
+		return err
+	})
+	// Other is still installed, but gone from the catalog
+	writeCatalog(t, path, logger, base)
+	runHistoryCommand(t, dir, "config update-catalog", func(fm *FunctionManager) error {
+		_, err := fm.CatMan.UpdateCatalog(uri)
+		return err
+	})
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	var tests = []struct {
+		fname     string
+		catalog   string
+		installed string
+		pinned    bool
+		// Installed versions are marked with a *
+		versions []string
+	}{
+		{"example.com/Logger", uri, "v1.1.0", true, []string{"v1.0.0", "v1.1.0*", "v2.0.0"}},
+		{"example.com/Base", uri, "", false, []string{"v1.0.0"}},
+		{"example.com/Other", "", "v1.0.0", false, []string{"v1.0.0*"}},
+	}
+
+	for _, test := range tests {
+		info, err := fm.Info(test.fname)
+		if err != nil {
+			t.Errorf("%s: %v", test.fname, err)
+			continue
+		}
+
+		var versions []string
+		for _, v := range info.Versions {
+			if v.Installed {
+				v.Name += "*"
+			}
+			versions = append(versions, v.Name)
+		}
+		if info.Catalog != test.catalog || info.Installed != (test.installed != "") || info.InstalledVersion != test.installed ||
+			info.Pinned != test.pinned || !reflect.DeepEqual(versions, test.versions) {
+			t.Errorf("%s: got catalog '%s', installed %v at '%s', pinned %v, versions %v", test.fname,
+				info.Catalog, info.Installed, info.InstalledVersion, info.Pinned, versions)
+		}
+	}
+
+	if _, err := fm.Info("example.com/Missing"); err == nil {
+		t.Error("expected an error for a function that is neither installed nor in a catalog")
+	}
+}
@@ -1,8 +1,10 @@
 package kaffine
 
 import (
+	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -13,6 +15,8 @@ type FunctionCatalog struct {
 	Kind       string `json:"kind"`
 	Spec       struct {
 		KrmFunctions []FunctionDefinition `json:"krmFunctions"`
+		// Problems with some versions of the functions, see Advisory
+		Advisories []Advisory `json:"advisories,omitempty"`
 	} `json:"spec"`
 	// optional
 	Metadata *v1.ObjectMeta `json:"metadata,omitempty"`
@@ -30,6 +34,97 @@ func MakeFunctionCatalog(name string) (fc FunctionCatalog) {
 
 var IgnoreAutoUpdates string = "kaffine.config/ignore-auto-updates"
 
+// Set when a function was installed with a constraint like "^1.2"
+var VersionConstraintAnnotation string = "kaffine.config/version-constraint"
+
+// Whether the function was installed with a fixed version
+func IsPinned(fd FunctionDefinition) bool {
+	return fd.Metadata != nil && fd.Metadata.Annotations[IgnoreAutoUpdates] == "true"
+}
+
+// The constraint the function was installed with, if any
+func GetVersionConstraint(fd FunctionDefinition) string {
+	if fd.Metadata == nil {
+		return ""
+	}
+
+	return fd.Metadata.Annotations[VersionConstraintAnnotation]
+}
+
+// Records what version was asked for when installing. An exact version pins
+// the function, a constraint limits which versions updates may pick.
+func SetRequestedVersion(fd *FunctionDefinition, version string) {
+	if fd.Metadata == nil {
+		fd.Metadata = &v1.ObjectMeta{}
+	}
+	if fd.Metadata.Annotations == nil {
+		fd.Metadata.Annotations = map[string]string{}
+	}
+
+	fd.Metadata.Annotations[IgnoreAutoUpdates] = strconv.FormatBool(version != "" && !IsConstraint(version))
+	if IsConstraint(version) {
+		fd.Metadata.Annotations[VersionConstraintAnnotation] = version
+	} else {
+		delete(fd.Metadata.Annotations, VersionConstraintAnnotation)
+	}
+}
+
+// Wrapped by the errors of SelectVersion that are down to yanked versions
+var ErrYanked = errors.New("yanked")
+
+// Narrows a catalog definition down to the single version that gets installed
+// for the requested version, which may be empty, exact or a constraint. Only
+// an exact version can pick a yanked one.
+func SelectVersion(fd FunctionDefinition, version string) (FunctionDefinition, error) {
+	var v FunctionVersion
+	if version == "" || IsConstraint(version) {
+		if fd.Yanked {
+			return fd, fmt.Errorf("'%s' has been %w, it can only be installed with an exact version", fd.GroupName(), ErrYanked)
+		}
+		var versions []FunctionVersion
+		for _, x := range fd.Versions {
+			if version == "" || MatchesVersion(x.Name, version) {
+				versions = append(versions, x)
+			}
+		}
+		if len(versions) == 0 {
+			return fd, fmt.Errorf("no version of '%s' matches '%s'", fd.GroupName(), version)
+		}
+		if versions = unyanked(versions); len(versions) == 0 {
+			return fd, fmt.Errorf("every version of '%s' matching '%s' has been %w", fd.GroupName(), version, ErrYanked)
+		}
+		fd.Versions = versions
+		v = fd.GetHighestVersion()
+	} else {
+		var err error
+		if v, err = fd.GetVersion(version); err != nil {
+			return fd, err
+		}
+	}
+
+	fd.Versions = []FunctionVersion{v}
+	// Don't share annotations with the catalog
+	if fd.Metadata != nil {
+		fd.Metadata = fd.Metadata.DeepCopy()
+	}
+	SetRequestedVersion(&fd, version)
+
+	return fd, nil
+}
+
+// How the function is listed in the config, e.g. "example.com/Logger@v1.0.0"
+// for a pinned function
+func Requirement(fd FunctionDefinition) string {
+	if IsPinned(fd) && len(fd.Versions) > 0 {
+		return fd.GroupName() + "@" + fd.Versions[0].Name
+	}
+	if constraint := GetVersionConstraint(fd); constraint != "" {
+		return fd.GroupName() + "@" + constraint
+	}
+
+	return fd.GroupName()
+}
+
 type FunctionDefinition struct {
 	// required
 	Group       string `json:"group"`
@@ -44,15 +139,26 @@ type FunctionDefinition struct {
 	Maintainers []string       `json:"maintainers,omitempty"`
 	Tags        []string       `json:"tags,omitempty"`
 	Metadata    *v1.ObjectMeta `json:"metadata,omitempty"`
+	// Applies to every version
+	Deprecated *Deprecation `json:"deprecated,omitempty"`
+	Yanked     bool         `json:"yanked,omitempty"`
+	// Needed by every version
+	Dependencies []FunctionDependency `json:"dependencies,omitempty"`
 }
 
-// Right now just lexicographically compares the version names
+// Compares version names semantically, see CompareVersions. Yanked versions
+// are skipped, unless every version is yanked.
 func (m FunctionDefinition) GetHighestVersion() FunctionVersion {
-	sort.Slice(m.Versions, func(i, j int) bool {
-		return m.Versions[i].Name < m.Versions[j].Name
+	// Sort a copy so the catalog keeps its own ordering
+	versions := unyanked(m.Versions)
+	if len(versions) == 0 {
+		versions = append([]FunctionVersion{}, m.Versions...)
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i].Name, versions[j].Name) < 0
 	})
 
-	return m.Versions[len(m.Versions)-1]
+	return versions[len(versions)-1]
 }
 
 func (m FunctionDefinition) GetVersion(v string) (fv FunctionVersion, err error) {
@@ -62,7 +168,7 @@ func (m FunctionDefinition) GetVersion(v string) (fv FunctionVersion, err error)
 		}
 	}
 
-	return fv, fmt.Errorf("no version '%s' in function '%s'", m.GroupName(), v)
+	return fv, fmt.Errorf("no version '%s' in function '%s'", v, m.GroupName())
 }
 
 // Get rightmost @ and get rightmost /
@@ -91,6 +197,12 @@ func (m FunctionDefinition) GroupName() string {
 	return m.Group + "/" + m.Names.Kind
 }
 
+func SortFunctionDefinitions(fns []FunctionDefinition) {
+	sort.SliceStable(fns, func(i, j int) bool {
+		return fns[i].GroupName() < fns[j].GroupName()
+	})
+}
+
 type FunctionVersion struct {
 	// required
 	// Schema     struct{ OpenAPIV3Schema v1beta1.JSONSchemaProps `json:"openAPIV3Schema"` }  `json:"schema"`
@@ -104,7 +216,19 @@ type FunctionVersion struct {
 		Exec      FunctionRuntimeExec      `json:"exec,omitempty"`
 	} `json:"runtime"`
 	// optional
-	Maintainers []string `json:"maintainers,omitempty"`
+	Maintainers []string     `json:"maintainers,omitempty"`
+	Deprecated  *Deprecation `json:"deprecated,omitempty"`
+	// Only installed when asked for by name, never picked by an update
+	Yanked bool `json:"yanked,omitempty"`
+	// Needed by this version, on top of the ones of the function
+	Dependencies []FunctionDependency `json:"dependencies,omitempty"`
+}
+
+// Why a function or version should no longer be used
+type Deprecation struct {
+	Message string `json:"message,omitempty"`
+	// Function or version to use instead
+	Replacement string `json:"replacement,omitempty"`
 }
 
 type FunctionRuntimeContainer struct {
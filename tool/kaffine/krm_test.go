@@ -24,3 +24,44 @@ func TestToGroupNameVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectVersionSkipsYanked(t *testing.T) {
+	fd := FunctionDefinition{Group: "example.com"}
+	fd.Names.Kind = "Logger"
+	fd.Versions = []FunctionVersion{{Name: "v1.1.0", Yanked: true}, {Name: "v1.0.1"}, {Name: "v1.0.0"}, {Name: "v0.9.0", Yanked: true}}
+	allYanked := fd
+	allYanked.Yanked = true
+
+	var tests = []struct {
+		fd      FunctionDefinition
+		version string
+		want    string
+	}{
+		{fd, "", "v1.0.1"},
+		{fd, "^1.0", "v1.0.1"},
+		{fd, "v1.1.0", "v1.1.0"},
+		{fd, "<1.0.0", ""},
+		{allYanked, "", ""},
+		{allYanked, "^1.0", ""},
+		{allYanked, "v1.0.0", "v1.0.0"},
+	}
+
+	for _, test := range tests {
+		selected, err := SelectVersion(test.fd, test.version)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.version, selected.Versions[0].Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.version, err)
+		} else if selected.Versions[0].Name != test.want {
+			t.Errorf("%q: got %s, want %s", test.version, selected.Versions[0].Name, test.want)
+		}
+	}
+
+	if v := fd.GetHighestVersion().Name; v != "v1.0.1" {
+		t.Errorf("GetHighestVersion() = %s, want v1.0.1", v)
+	}
+}
@@ -0,0 +1,448 @@
+package kaffine
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"golang.org/x/exp/maps"
+)
+
+// How restrictive a license is, from least to most
+var licenseCategories = []string{"permissive", "weak-copyleft", "copyleft", "unknown", "missing"}
+
+type spdxLicense struct {
+	ID       string
+	Category string
+	// Other ways catalogs write it, on top of the ID itself
+	Aliases []string
+}
+
+var spdxLicenses = []spdxLicense{
+	{"0BSD", "permissive", []string{"Zero-Clause BSD"}},
+	{"Apache-2.0", "permissive", []string{"Apache 2", "Apache2", "Apache License, Version 2.0", "ASL 2.0"}},
+	{"BSD-2-Clause", "permissive", []string{"BSD-2", "Simplified BSD", "FreeBSD"}},
+	{"BSD-3-Clause", "permissive", []string{"BSD-3", "New BSD", "Modified BSD"}},
+	{"BSL-1.0", "permissive", []string{"Boost", "Boost Software License 1.0"}},
+	{"CC0-1.0", "permissive", []string{"CC0"}},
+	{"ISC", "permissive", nil},
+	{"MIT", "permissive", []string{"Expat", "MIT License"}},
+	{"Unlicense", "permissive", []string{"The Unlicense"}},
+	{"Zlib", "permissive", nil},
+	{"CDDL-1.0", "weak-copyleft", []string{"CDDL"}},
+	{"EPL-1.0", "weak-copyleft", []string{"EPLv1", "Eclipse Public License 1.0"}},
+	{"EPL-2.0", "weak-copyleft", []string{"EPLv2", "Eclipse Public License 2.0"}},
+	{"LGPL-2.1-only", "weak-copyleft", []string{"LGPL-2.1", "LGPLv2.1"}},
+	{"LGPL-2.1-or-later", "weak-copyleft", []string{"LGPL-2.1+", "LGPLv2.1+", "LGPLv2.1 or later"}},
+	{"LGPL-3.0-only", "weak-copyleft", []string{"LGPL-3.0", "LGPLv3", "LGPL-3"}},
+	{"LGPL-3.0-or-later", "weak-copyleft", []string{"LGPL-3.0+", "LGPLv3+", "LGPLv3 or later"}},
+	{"MPL-2.0", "weak-copyleft", []string{"MPLv2", "MPL 2", "Mozilla Public License 2.0"}},
+	{"AGPL-3.0-only", "copyleft", []string{"AGPL-3.0", "AGPLv3"}},
+	{"AGPL-3.0-or-later", "copyleft", []string{"AGPL-3.0+", "AGPLv3+", "AGPLv3 or later"}},
+	{"GPL-2.0-only", "copyleft", []string{"GPL-2.0", "GPLv2", "GPL-2"}},
+	{"GPL-2.0-or-later", "copyleft", []string{"GPL-2.0+", "GPLv2+", "GPLv2 or later"}},
+	{"GPL-3.0-only", "copyleft", []string{"GPL-3.0", "GPLv3", "GPL-3"}},
+	{"GPL-3.0-or-later", "copyleft", []string{"GPL-3.0+", "GPLv3+", "GPLv3 or later"}},
+}
+
+// Every ID and alias by licenseKey
+var spdxByKey = func() map[string]spdxLicense {
+	byKey := map[string]spdxLicense{}
+	for _, l := range spdxLicenses {
+		byKey[licenseKey(l.ID)] = l
+		for _, alias := range l.Aliases {
+			byKey[licenseKey(alias)] = l
+		}
+	}
+
+	return byKey
+}()
+
+var licensePhrases = strings.NewReplacer(
+	"lesser general public license", "lgpl",
+	"library general public license", "lgpl",
+	"affero general public license", "agpl",
+	"general public license", "gpl",
+)
+
+var licenseVersion = regexp.MustCompile(`v(\d)`)
+
+// Reduces a license name to what tells it apart, so "Apache License, Version
+// 2.0", "apache-2.0" and "Apache 2.0" all end up as apache20
+func licenseKey(name string) string {
+	name = licensePhrases.Replace(strings.ToLower(name))
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+'
+	})
+
+	var key strings.Builder
+	for _, word := range words {
+		switch word {
+		case "the", "gnu", "license", "licence", "version":
+		default:
+			key.WriteString(word)
+		}
+	}
+
+	return licenseVersion.ReplaceAllString(key.String(), "$1")
+}
+
+// Turns a license as written in a catalog into an SPDX expression, and how
+// restrictive it is. The AND, OR and WITH operators, in upper case as SPDX
+// writes them, and parentheses are understood, and an OR is as restrictive as
+// its most permissive choice. Licenses that are not recognized are kept as
+// written and make the category unknown.
+func NormalizeLicense(license string) (spdx string, category string) {
+	if strings.TrimSpace(license) == "" {
+		return "", "missing"
+	}
+
+	p := &licenseParser{tokens: tokenizeLicense(license)}
+	expr, ok := p.parseOr()
+	if !ok || p.pos < len(p.tokens) {
+		return strings.TrimSpace(license), "unknown"
+	}
+
+	return expr.text, expr.category
+}
+
+type licenseExpr struct {
+	text     string
+	category string
+	// Needs parentheses inside an AND
+	or bool
+	// By the parser's allowed licenses
+	allowed bool
+	// A valid SPDX expression, with LicenseRef-s for unknown licenses, whose
+	// names are in refs
+	spdx string
+	refs map[string]string
+}
+
+type licenseParser struct {
+	tokens []string
+	pos    int
+	// Lowercase SPDX ids, for licenseAllowed
+	allowed map[string]bool
+}
+
+func tokenizeLicense(license string) []string {
+	license = strings.NewReplacer("(", " ( ", ")", " ) ", "/", " OR ").Replace(license)
+	return strings.Fields(license)
+}
+
+func (p *licenseParser) next(token string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos] == token {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *licenseParser) parseOr() (expr licenseExpr, ok bool) {
+	if expr, ok = p.parseAnd(); !ok {
+		return
+	}
+	for p.next("OR") {
+		right, ok := p.parseAnd()
+		if !ok {
+			return expr, false
+		}
+		expr = licenseExpr{
+			text:     expr.text + " OR " + right.text,
+			category: leastRestrictive(expr.category, right.category),
+			or:       true,
+			allowed:  expr.allowed || right.allowed,
+			spdx:     expr.spdx + " OR " + right.spdx,
+			refs:     mergeRefs(expr.refs, right.refs),
+		}
+	}
+
+	return expr, true
+}
+
+func (p *licenseParser) parseAnd() (expr licenseExpr, ok bool) {
+	if expr, ok = p.parseWith(); !ok {
+		return
+	}
+	for p.next("AND") {
+		right, ok := p.parseWith()
+		if !ok {
+			return expr, false
+		}
+		expr = licenseExpr{
+			text:     parenthesize(expr, expr.text) + " AND " + parenthesize(right, right.text),
+			category: mostRestrictive(expr.category, right.category),
+			allowed:  expr.allowed && right.allowed,
+			spdx:     parenthesize(expr, expr.spdx) + " AND " + parenthesize(right, right.spdx),
+			refs:     mergeRefs(expr.refs, right.refs),
+		}
+	}
+
+	return expr, true
+}
+
+func (p *licenseParser) parseWith() (expr licenseExpr, ok bool) {
+	if p.next("(") {
+		if expr, ok = p.parseOr(); !ok || !p.next(")") {
+			return expr, false
+		}
+		return expr, true
+	}
+
+	name := p.parseName()
+	if name == "" {
+		return expr, false
+	}
+	ref := "LicenseRef-" + spdxID(name)
+	expr = licenseExpr{text: name, category: "unknown", spdx: ref, refs: map[string]string{ref: name}}
+	if l, ok := spdxByKey[licenseKey(name)]; ok {
+		expr = licenseExpr{text: l.ID, category: l.Category, spdx: l.ID}
+	}
+	expr.allowed = p.allowed[strings.ToLower(expr.text)]
+
+	// Exceptions only ever grant more, so the license keeps its category and
+	// is allowed when its base license is
+	if p.next("WITH") {
+		exception := p.parseName()
+		if exception == "" {
+			return expr, false
+		}
+		expr.text += " WITH " + exception
+		expr.spdx += " WITH " + spdxID(exception)
+	}
+
+	return expr, true
+}
+
+// Words up to the next operator or parenthesis
+func (p *licenseParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.tokens) {
+		switch p.tokens[p.pos] {
+		case "AND", "OR", "WITH", "(", ")":
+			return strings.Join(p.tokens[start:p.pos], " ")
+		}
+		p.pos++
+	}
+
+	return strings.Join(p.tokens[start:p.pos], " ")
+}
+
+// text is expr's text or spdx
+func parenthesize(expr licenseExpr, text string) string {
+	if expr.or {
+		return "(" + text + ")"
+	}
+
+	return text
+}
+
+func mergeRefs(a, b map[string]string) map[string]string {
+	if len(b) == 0 {
+		return a
+	}
+	merged := maps.Clone(a)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	maps.Copy(merged, b)
+
+	return merged
+}
+
+// The license as an expression SBOM tools accept, where every license that
+// is not on the SPDX list becomes a LicenseRef-, with the names it stands for
+// in refs. Empty when the license is missing or does not parse.
+func SPDXExpression(license string) (expr string, refs map[string]string) {
+	p := &licenseParser{tokens: tokenizeLicense(license)}
+	parsed, ok := p.parseOr()
+	if !ok || p.pos < len(p.tokens) {
+		return "", nil
+	}
+
+	return parsed.spdx, parsed.refs
+}
+
+func categoryRank(category string) int {
+	for i, c := range licenseCategories {
+		if c == category {
+			return i
+		}
+	}
+
+	return len(licenseCategories)
+}
+
+func leastRestrictive(a, b string) string {
+	if categoryRank(b) < categoryRank(a) {
+		return b
+	}
+
+	return a
+}
+
+func mostRestrictive(a, b string) string {
+	if categoryRank(b) > categoryRank(a) {
+		return b
+	}
+
+	return a
+}
+
+// Whether license is allowed, comparing the SPDX forms. In an expression an
+// OR needs one allowed side and an AND both, and a license WITH an exception
+// counts as the license. An allowed entry that is the whole expression also
+// passes.
+func licenseAllowed(allowed []string, license string) bool {
+	ids := map[string]bool{}
+	for _, a := range allowed {
+		if id, _ := NormalizeLicense(a); id != "" {
+			ids[strings.ToLower(id)] = true
+		}
+	}
+
+	spdx, _ := NormalizeLicense(license)
+	if spdx == "" {
+		return false
+	}
+	if ids[strings.ToLower(spdx)] {
+		return true
+	}
+
+	p := &licenseParser{tokens: tokenizeLicense(license), allowed: ids}
+	expr, ok := p.parseOr()
+
+	return ok && p.pos == len(p.tokens) && expr.allowed
+}
+
+type LicenseItem struct {
+	Function string `json:"function"`
+	Version  string `json:"version"`
+	// SPDX expression, or the license as written when it is not recognized
+	License  string `json:"license"`
+	Category string `json:"category"`
+	// As written in the catalog, when it differs from License
+	Declared string `json:"declared,omitempty"`
+	// Fails `licenses --deny`
+	Denied bool `json:"denied"`
+}
+
+type LicenseReport struct {
+	Items []LicenseItem `json:"items"`
+	// The allowedLicenses of the policy decide what is denied instead of the
+	// category, when the policy has them
+	Policy string `json:"policy,omitempty"`
+}
+
+// The license of every installed function, grouped by license with missing
+// ones last. Weak and strong copyleft, unknown and missing licenses are
+// denied, unless the policy lists the allowed licenses, then anything it
+// does not list is.
+func (fm *FunctionManager) Licenses() (report LicenseReport) {
+	allowed := []string(nil)
+	if fm.Policy != nil && len(fm.Policy.AllowedLicenses) > 0 {
+		allowed = fm.Policy.AllowedLicenses
+		report.Policy = fm.Policy.FilePath
+	}
+
+	report.Items = []LicenseItem{}
+	for _, groupName := range fm.InstalledNames() {
+		fd := fm.Installed[groupName]
+		var v FunctionVersion
+		if len(fd.Versions) > 0 {
+			v = fd.Versions[0]
+		}
+
+		item := LicenseItem{Function: groupName, Version: v.Name}
+		item.License, item.Category = NormalizeLicense(v.License)
+		if declared := strings.TrimSpace(v.License); declared != item.License {
+			item.Declared = declared
+		}
+		if allowed != nil {
+			item.Denied = !licenseAllowed(allowed, v.License)
+		} else {
+			item.Denied = item.Category != "permissive"
+		}
+
+		report.Items = append(report.Items, item)
+	}
+
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		a, b := report.Items[i].License, report.Items[j].License
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		return strings.ToLower(a) < strings.ToLower(b)
+	})
+
+	return
+}
+
+func (report LicenseReport) Denied() (items []LicenseItem) {
+	for _, item := range report.Items {
+		if item.Denied {
+			items = append(items, item)
+		}
+	}
+
+	return
+}
+
+func (report LicenseReport) Header() []string {
+	return []string{"FUNCTION", "VERSION", "LICENSE", "CATEGORY", "DECLARED", "DENIED"}
+}
+
+func (report LicenseReport) Rows() (rows [][]string) {
+	for _, x := range report.Items {
+		rows = append(rows, []string{x.Function, x.Version, x.License, x.Category, x.Declared, strconv.FormatBool(x.Denied)})
+	}
+
+	return
+}
+
+// One block per license, with the functions under it
+func (report LicenseReport) Describe(w io.Writer) error {
+	var tw *tabwriter.Writer
+	for i, item := range report.Items {
+		if i == 0 || !strings.EqualFold(item.License, report.Items[i-1].License) {
+			if tw != nil {
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+				fmt.Fprintln(w)
+			}
+
+			switch item.Category {
+			case "missing":
+				fmt.Fprintln(w, "<missing>")
+			case "unknown":
+				fmt.Fprintf(w, "%s (unknown, not an SPDX license)\n", item.License)
+			default:
+				fmt.Fprintf(w, "%s (%s)\n", item.License, item.Category)
+			}
+			tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		}
+
+		line := fmt.Sprintf("  %s\t%s", item.Function, item.Version)
+		if item.Declared != "" && item.Category != "unknown" {
+			line += fmt.Sprintf("\tdeclared as '%s'", item.Declared)
+		}
+		if item.Denied {
+			line += "\tdenied"
+		}
+		fmt.Fprintln(tw, line)
+	}
+
+	if tw != nil {
+		return tw.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package kaffine
+
+import "testing"
+
+func TestNormalizeLicense(t *testing.T) {
+	var tests = []struct {
+		license  string
+		spdx     string
+		category string
+	}{
+		{"", "", "missing"},
+		{"  ", "", "missing"},
+		{"Apache-2.0", "Apache-2.0", "permissive"},
+		{"apache 2.0", "Apache-2.0", "permissive"},
+		{"Apache License, Version 2.0", "Apache-2.0", "permissive"},
+		{"MIT License", "MIT", "permissive"},
+		{"BSD 3-Clause", "BSD-3-Clause", "permissive"},
+		{"The Unlicense", "Unlicense", "permissive"},
+		{"GPLv3", "GPL-3.0-only", "copyleft"},
+		{"GPL-2.0+", "GPL-2.0-or-later", "copyleft"},
+		{"GPLv2 or later", "GPL-2.0-or-later", "copyleft"},
+		{"GNU General Public License v3.0", "GPL-3.0-only", "copyleft"},
+		{"GNU Lesser General Public License v2.1", "LGPL-2.1-only", "weak-copyleft"},
+		{"GNU Affero General Public License v3", "AGPL-3.0-only", "copyleft"},
+		{"Mozilla Public License 2.0", "MPL-2.0", "weak-copyleft"},
+		{"MIT OR GPL-3.0", "MIT OR GPL-3.0-only", "permissive"},
+		{"MIT/Apache 2.0", "MIT OR Apache-2.0", "permissive"},
+		{"MIT AND GPLv2", "MIT AND GPL-2.0-only", "copyleft"},
+		{"(MIT OR GPL-3.0) AND LGPLv3", "(MIT OR GPL-3.0-only) AND LGPL-3.0-only", "weak-copyleft"},
+		{"GPL-2.0-or-later WITH Classpath-exception-2.0", "GPL-2.0-or-later WITH Classpath-exception-2.0", "copyleft"},
+		{"MIT OR Acme Commercial", "MIT OR Acme Commercial", "permissive"},
+		{"MIT AND Acme Commercial", "MIT AND Acme Commercial", "unknown"},
+		{"Proprietary", "Proprietary", "unknown"},
+		{"GPL", "GPL", "unknown"},
+		{"(MIT", "(MIT", "unknown"},
+	}
+
+	for _, test := range tests {
+		spdx, category := NormalizeLicense(test.license)
+		if spdx != test.spdx || category != test.category {
+			t.Errorf("NormalizeLicense(%q) = %q, %q, want %q, %q", test.license, spdx, category, test.spdx, test.category)
+		}
+	}
+}
+
+func TestLicenseAllowed(t *testing.T) {
+	allowed := []string{"apache 2.0", "MIT"}
+	var tests = []struct {
+		license string
+		allowed bool
+	}{
+		{"Apache-2.0", true},
+		{"Apache License, Version 2.0", true},
+		{"mit", true},
+		{"BSD-3-Clause", false},
+		{"", false},
+		{"MIT OR Apache-2.0", true},
+		{"MIT OR GPL-3.0-only", true},
+		{"MIT AND Apache-2.0", true},
+		{"MIT AND GPL-3.0-only", false},
+		{"Apache-2.0 WITH LLVM-exception", true},
+		{"GPL-2.0-only WITH Classpath-exception-2.0", false},
+		{"(GPL-3.0-only OR MIT) AND (Apache-2.0 OR BSD-3-Clause)", true},
+		{"GPL-3.0-only AND (MIT OR Apache-2.0)", false},
+		{"MIT OR Acme Commercial", true},
+	}
+
+	for _, test := range tests {
+		if ok := licenseAllowed(allowed, test.license); ok != test.allowed {
+			t.Errorf("licenseAllowed(%v, %q) = %v, want %v", allowed, test.license, ok, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package kaffine
+
+import (
+	"fmt"
+)
+
+func unyanked(versions []FunctionVersion) (kept []FunctionVersion) {
+	for _, v := range versions {
+		if !v.Yanked {
+			kept = append(kept, v)
+		}
+	}
+
+	return
+}
+
+func (d *Deprecation) String() string {
+	s := "deprecated"
+	if d.Message != "" {
+		s += ": " + d.Message
+	}
+	if d.Replacement != "" {
+		s += fmt.Sprintf(" (use %s instead)", d.Replacement)
+	}
+
+	return s
+}
+
+// "yanked" or "deprecated" when the catalog definition fd says so for the
+// function or its version, otherwise empty
+func LifecycleStatus(fd FunctionDefinition, version string) string {
+	v, err := fd.GetVersion(version)
+	switch {
+	case fd.Yanked || (err == nil && v.Yanked):
+		return "yanked"
+	case fd.Deprecated != nil || (err == nil && v.Deprecated != nil):
+		return "deprecated"
+	}
+
+	return ""
+}
+
+// What the user should hear about using version of the function, going by
+// its definition in cm. Yanked versions are shouted about. If the function was
+// already installed at version, only its pin keeps it there.
+func LifecycleWarnings(cm *CatalogManager, groupName string, version string, installed bool) (warnings []string) {
+	cm.Load()
+	fd, ok := cm.Functions[groupName]
+	if !ok {
+		return nil
+	}
+	v, err := fd.GetVersion(version)
+	if err != nil {
+		v = FunctionVersion{}
+	}
+
+	switch {
+	case v.Yanked && installed:
+		warnings = append(warnings, fmt.Sprintf("WARNING: %s@%s has been YANKED from its catalog and is only still used because it is pinned", groupName, version))
+	case v.Yanked:
+		warnings = append(warnings, fmt.Sprintf("WARNING: %s@%s has been YANKED from its catalog", groupName, version))
+	case fd.Yanked && installed:
+		warnings = append(warnings, fmt.Sprintf("WARNING: %s has been YANKED from its catalog, %s is only still used because it is pinned", groupName, version))
+	case fd.Yanked:
+		warnings = append(warnings, fmt.Sprintf("WARNING: %s has been YANKED from its catalog", groupName))
+	}
+	if fd.Deprecated != nil {
+		warnings = append(warnings, fmt.Sprintf("warning: %s is %s", groupName, fd.Deprecated))
+	}
+	if v.Deprecated != nil {
+		warnings = append(warnings, fmt.Sprintf("warning: %s@%s is %s", groupName, version, v.Deprecated))
+	}
+
+	return
+}
@@ -0,0 +1,36 @@
+package kaffine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLifecycleWarningsYanked(t *testing.T) {
+	version := makeDependencyFunction("Logger", map[string][]FunctionDependency{"v1.0.0": nil, "v1.1.0": nil})
+	version.Versions[0].Yanked = true
+	function := makeDependencyFunction("Logger", map[string][]FunctionDependency{"v1.0.0": nil})
+	function.Yanked = true
+
+	var tests = []struct {
+		name      string
+		fd        FunctionDefinition
+		installed bool
+	}{
+		{"version yanked, first install", version, false},
+		{"version yanked, already installed", version, true},
+		{"function yanked, first install", function, false},
+		{"function yanked, already installed", function, true},
+	}
+
+	for _, test := range tests {
+		cm := &CatalogManager{Functions: map[string]FunctionDefinition{test.fd.GroupName(): test.fd}, loaded: true}
+		warnings := LifecycleWarnings(cm, "example.com/Logger", "v1.0.0", test.installed)
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "YANKED") {
+			t.Errorf("%s: expected a yanked warning, got %v", test.name, warnings)
+			continue
+		}
+		if pinned := strings.Contains(warnings[0], "because it is pinned"); pinned != test.installed {
+			t.Errorf("%s: got %q", test.name, warnings[0])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package kaffine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LockMode int
+
+const (
+	SharedLock LockMode = iota
+	ExclusiveLock
+)
+
+// How long to wait for another kaffine process to release the lock
+var LockTimeout time.Duration = 30 * time.Second
+
+var lockPollInterval = 50 * time.Millisecond
+
+var errLockHeld = errors.New("lock held by another process")
+
+// Advisory lock on the kaffine directory. Exclusive holders record their pid
+// in the lock file so that waiting processes can report who is holding it.
+type FileLock struct {
+	Mode LockMode
+
+	file *os.File
+}
+
+func AcquireLock(directory string, mode LockMode, timeout time.Duration) (*FileLock, error) {
+	file, err := os.OpenFile(filepath.Join(directory, "kaffine.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = lockFile(file, mode)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockHeld) {
+			file.Close()
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			holder := readLockHolder(file)
+			file.Close()
+			if holder == "" {
+				return nil, fmt.Errorf("another kaffine process holds the lock (timed out after %v)", timeout)
+			}
+			return nil, fmt.Errorf("another kaffine process holds the lock (pid %s) (timed out after %v)", holder, timeout)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	if mode == ExclusiveLock {
+		file.Truncate(0)
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+
+	return &FileLock{Mode: mode, file: file}, nil
+}
+
+func (l *FileLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	if l.Mode == ExclusiveLock {
+		l.file.Truncate(0)
+	}
+
+	err := unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+func readLockHolder(file *os.File) string {
+	b, err := os.ReadFile(file.Name())
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
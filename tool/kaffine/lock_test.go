@@ -0,0 +1,52 @@
+package kaffine
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir := t.TempDir()
+	timeout := 100 * time.Millisecond
+
+	var tests = []struct {
+		held, want LockMode
+		ok         bool
+	}{
+		{SharedLock, SharedLock, true},
+		{SharedLock, ExclusiveLock, false},
+		{ExclusiveLock, SharedLock, false},
+		{ExclusiveLock, ExclusiveLock, false},
+	}
+
+	for _, test := range tests {
+		held, err := AcquireLock(dir, test.held, timeout)
+		if err != nil {
+			t.Fatalf("acquiring held lock: %v", err)
+		}
+
+		lock, err := AcquireLock(dir, test.want, timeout)
+		if test.ok && err != nil {
+			t.Errorf("%v then %v: unexpected error: %v", test.held, test.want, err)
+		}
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%v then %v: expected error", test.held, test.want)
+			} else if test.held == ExclusiveLock && !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+				t.Errorf("%v then %v: error does not name holder: %v", test.held, test.want, err)
+			}
+		}
+
+		lock.Release()
+		held.Release()
+	}
+
+	lock, err := AcquireLock(dir, ExclusiveLock, timeout)
+	if err != nil {
+		t.Errorf("lock not released: %v", err)
+	}
+	lock.Release()
+}
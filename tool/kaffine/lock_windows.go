@@ -0,0 +1,34 @@
+//go:build windows
+
+package kaffine
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows locks are mandatory, so only a byte far past the pid is locked and
+// waiting processes can still read who holds it
+var lockRange = windows.Overlapped{OffsetHigh: 0x7fffffff}
+
+func lockFile(file *os.File, mode LockMode) error {
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if mode == ExclusiveLock {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	overlapped := lockRange
+	err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLockHeld
+	}
+
+	return err
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := lockRange
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped)
+}
@@ -0,0 +1,116 @@
+package kaffine
+
+import (
+	"strconv"
+)
+
+type OutdatedItem struct {
+	Function   string   `json:"function"`
+	Current    string   `json:"current"`
+	Wanted     string   `json:"wanted"`
+	Latest     string   `json:"latest"`
+	Pinned     bool     `json:"pinned"`
+	Constraint string   `json:"constraint,omitempty"`
+	Outdated   bool     `json:"outdated"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+type OutdatedReport struct {
+	Items []OutdatedItem `json:"items"`
+}
+
+// Compares every installed function against the catalogs in cm. Wanted is
+// the newest version allowed by the pin or constraint, latest the newest
+// version overall.
+func (fm *FunctionManager) Outdated(cm *CatalogManager) (report OutdatedReport) {
+	cm.Load()
+	report.Items = []OutdatedItem{}
+	for _, groupName := range fm.InstalledNames() {
+		installed := fm.Installed[groupName]
+		item := OutdatedItem{
+			Function:   groupName,
+			Current:    installed.Versions[0].Name,
+			Pinned:     IsPinned(installed),
+			Constraint: GetVersionConstraint(installed),
+			Tags:       installed.Tags,
+		}
+
+		if fd, ok := cm.Functions[groupName]; ok {
+			item.Tags = fd.Tags
+			item.Latest = fd.GetHighestVersion().Name
+			item.Wanted = item.Latest
+
+			if item.Pinned {
+				item.Wanted = item.Current
+			} else if item.Constraint != "" {
+				item.Wanted = ""
+				if constrained, err := cm.SearchExact(groupName + "@" + item.Constraint); err == nil {
+					item.Wanted = constrained.GetHighestVersion().Name
+				}
+			}
+		}
+
+		item.Outdated = item.Wanted != "" && CompareVersions(item.Current, item.Wanted) < 0
+		report.Items = append(report.Items, item)
+	}
+
+	return
+}
+
+// Only keeps functions with at least one of the tags
+func (report OutdatedReport) FilterTags(tags []string) (filtered OutdatedReport) {
+	filtered.Items = []OutdatedItem{}
+	for _, item := range report.Items {
+		if len(tags) == 0 || hasAnyTag(item.Tags, tags) {
+			filtered.Items = append(filtered.Items, item)
+		}
+	}
+
+	return
+}
+
+func (report OutdatedReport) CountOutdated() (n int) {
+	for _, item := range report.Items {
+		if item.Outdated {
+			n++
+		}
+	}
+
+	return
+}
+
+func (report OutdatedReport) Header() []string {
+	return []string{"FUNCTION", "CURRENT", "WANTED", "LATEST", "PINNED"}
+}
+
+func (report OutdatedReport) Rows() (rows [][]string) {
+	for _, x := range report.Items {
+		pinned := strconv.FormatBool(x.Pinned)
+		if x.Constraint != "" {
+			pinned = x.Constraint
+		}
+		rows = append(rows, []string{x.Function, x.Current, orNone(x.Wanted), orNone(x.Latest), pinned})
+	}
+
+	return
+}
+
+func hasAnyTag(have []string, want []string) bool {
+	for _, x := range have {
+		for _, y := range want {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+
+	return s
+}
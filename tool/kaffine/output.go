@@ -0,0 +1,99 @@
+package kaffine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Set by the global -o flag
+var OutputFormat string = "table"
+
+var OutputFormats = []string{"yaml", "json", "table", "name", "csv"}
+
+// Results that can be shown as a table. The first column is what -o name prints.
+type Table interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// Results with a free-form human readable view use it instead of a table
+type Describer interface {
+	Describe(w io.Writer) error
+}
+
+func ValidateOutputFormat(format string) error {
+	for _, f := range OutputFormats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output format '%s' (expected one of %s)", format, strings.Join(OutputFormats, "|"))
+}
+
+// Writes result in the format chosen with -o
+func Print(w io.Writer, result interface{}) error {
+	switch OutputFormat {
+	case "json":
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(b))
+
+	case "name":
+		t, ok := result.(Table)
+		if !ok {
+			return fmt.Errorf("output format 'name' is not supported by this command")
+		}
+		for _, row := range t.Rows() {
+			if len(row) > 0 {
+				fmt.Fprintln(w, row[0])
+			}
+		}
+
+	case "csv":
+		t, ok := result.(Table)
+		if !ok {
+			return fmt.Errorf("output format 'csv' is not supported by this command")
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(t.Header())
+		cw.WriteAll(t.Rows())
+		return cw.Error()
+
+	case "table":
+		if d, ok := result.(Describer); ok {
+			return d.Describe(w)
+		}
+		if t, ok := result.(Table); ok {
+			return WriteTable(w, t)
+		}
+		fallthrough
+
+	default:
+		b, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, string(b))
+	}
+
+	return nil
+}
+
+func WriteTable(w io.Writer, t Table) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.Header(), "\t"))
+	for _, row := range t.Rows() {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
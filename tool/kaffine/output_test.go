@@ -0,0 +1,138 @@
+package kaffine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Listing the same workspace twice prints the same thing in every format
+func TestOutputIsStable(t *testing.T) {
+	dir := makeTestDirectory(t, 2)
+	t.Cleanup(func() { OutputFormat = "table" })
+
+	list := func(format string) string {
+		fm, err := NewFunctionManager(dir, SharedLock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fm.Close()
+
+		OutputFormat = format
+		var buf bytes.Buffer
+		if err = Print(&buf, fm.ListFunctionDefinitions()); err != nil {
+			t.Fatal(err)
+		}
+
+		return strings.ReplaceAll(buf.String(), dir, "DIR")
+	}
+
+	var tests = []struct {
+		format, golden string
+	}{
+		{"json", ""},
+		{"yaml", `items:
+- catalog: file://DIR/catalog-0.yaml
+  description: Does things
+  function: example0.com/Function0
+  installed: true
+  pinned: false
+  version: v1.0.0
+- catalog: file://DIR/catalog-0.yaml
+  description: Does things
+  function: example0.com/Function1
+  installed: true
+  pinned: false
+  version: v1.0.0
+- catalog: file://DIR/catalog-0.yaml
+  description: Does things
+  function: example0.com/Function2
+  installed: true
+  pinned: false
+  version: v1.0.0
+`},
+		// Compared by fields, the column widths depend on the directory
+		{"table", `FUNCTION VERSION CATALOG PINNED STATUS
+example0.com/Function0 v1.0.0 file://DIR/catalog-0.yaml false
+example0.com/Function1 v1.0.0 file://DIR/catalog-0.yaml false
+example0.com/Function2 v1.0.0 file://DIR/catalog-0.yaml false
+`},
+	}
+
+	for _, test := range tests {
+		first, second := list(test.format), list(test.format)
+		if first != second {
+			t.Errorf("%s: output changed between runs:\n%s\n%s", test.format, first, second)
+		}
+
+		got := first
+		if test.format == "table" {
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+				lines = append(lines, strings.Join(strings.Fields(line), " "))
+			}
+			got = strings.Join(lines, "\n") + "\n"
+		}
+		if test.golden != "" && got != test.golden {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.format, test.golden, got)
+		}
+	}
+}
+
+// Adding a catalog and rolling back leaves installed.yaml and config.yaml as
+// they were, timestamps included
+func TestSavedFilesAreStable(t *testing.T) {
+	dir := makeTestDirectory(t, 2)
+	files := []string{filepath.Join(dir, "installed.yaml"), filepath.Join(dir, "config.yaml")}
+
+	// An older timestamp, so a new one shows even within the same second
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = regexp.MustCompile(`(?m)^  creationTimestamp: .*`).ReplaceAll(b, []byte(`  creationTimestamp: "2020-01-01T00:00:00Z"`))
+	if err = os.WriteFile(files[0], b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := func() (contents []string) {
+		for _, path := range files {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents = append(contents, string(b))
+		}
+
+		return
+	}
+	before := read()
+
+	extra := filepath.Join(dir, "extra.yaml")
+	writeHistoryCatalog(t, extra, "v1.0.0")
+	runHistoryCommand(t, dir, "config add-catalog", func(fm *FunctionManager) error {
+		return fm.CatMan.AddCatalog("file://" + extra)
+	})
+	// Writes installed.yaml again, with the same functions
+	runHistoryCommand(t, dir, "rollback", func(fm *FunctionManager) error {
+		h, err := fm.History()
+		if err != nil {
+			return err
+		}
+		id, err := h.DefaultRollback()
+		if err != nil {
+			return err
+		}
+		_, err = fm.Rollback(id)
+		return err
+	})
+
+	after := read()
+	for i, path := range files {
+		if after[i] != before[i] {
+			t.Errorf("%s changed:\n%s\n%s", filepath.Base(path), before[i], after[i])
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package kaffine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"golang.org/x/exp/maps"
+)
+
+// Limits what `kaffine update` touches. The zero value updates everything.
+type UpdateOptions struct {
+	// Installed functions to update, all of them if empty
+	Functions []string
+	// Catalogs to fetch again. If empty, the catalogs providing Functions, or
+	// all catalogs when Functions is empty too.
+	Catalogs []string
+	// New version or constraint for the single function in Functions. This is
+	// how pinned functions move to a new pin.
+	To string
+}
+
+type CatalogChange struct {
+	Catalog string `json:"catalog"`
+	// updated, unchanged or failed
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+type FunctionChange struct {
+	Function string `json:"function"`
+	// upgrade, downgrade, changed (same version, different runtime), repinned
+	// (same version, different pin or constraint), missing (no longer in any
+	// catalog), yanked (no version it may move to is left), added (a new
+	// dependency of a function that changes), blocked (by the policy or
+	// dependencies) or unchanged
+	Action    string `json:"action"`
+	Error     string `json:"error,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	FromImage string `json:"fromImage,omitempty"`
+	ToImage   string `json:"toImage,omitempty"`
+	Major     bool   `json:"major,omitempty"`
+	Pinned    bool   `json:"pinned,omitempty"`
+	// Affecting the version the function moves to
+	Advisories []Advisory `json:"advisories,omitempty"`
+	// About the version the function moves to being deprecated or yanked
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// What `kaffine update` is going to change. Nothing happens until the plan is
+// passed to ApplyPlan.
+type UpdatePlan struct {
+	DryRun    bool             `json:"dryRun"`
+	Catalogs  []CatalogChange  `json:"catalogs"`
+	Functions []FunctionChange `json:"functions"`
+
+	catalogs  *CatalogManager
+	installed map[string]FunctionDefinition
+}
+
+func (fm *FunctionManager) PlanUpdate(opts UpdateOptions) (plan UpdatePlan, err error) {
+	groupNames := fm.InstalledNames()
+	if len(opts.Functions) > 0 {
+		groupNames = nil
+		for _, fname := range opts.Functions {
+			groupName, err := fm.InstalledName(fname)
+			if err != nil {
+				return plan, err
+			}
+			groupNames = append(groupNames, groupName)
+		}
+	}
+	if opts.To != "" && len(opts.Functions) != 1 {
+		return plan, errors.New("a new version can only be given together with the single function to update")
+	}
+
+	fm.CatMan.Load()
+	uris := opts.Catalogs
+	for _, uri := range uris {
+		if _, ok := fm.CatMan.Catalogs[uri]; !ok {
+			return plan, fmt.Errorf("catalog '%s' is not managed by kaffine", uri)
+		}
+	}
+	if len(uris) == 0 && len(opts.Functions) == 0 {
+		uris = fm.CatMan.URIs
+	} else if len(uris) == 0 {
+		for _, groupName := range groupNames {
+			if uri := fm.CatMan.Source(groupName); uri != "" {
+				uris = append(uris, uri)
+			}
+		}
+	}
+
+	latest, errs := fm.CatMan.FetchLatest(uris)
+
+	plan.Catalogs = []CatalogChange{}
+	for _, uri := range fm.CatMan.URIs {
+		change := CatalogChange{Catalog: uri, Action: "unchanged"}
+		if err, ok := errs[uri]; ok {
+			change.Action = "failed"
+			change.Error = err.Error()
+		} else if !reflect.DeepEqual(fm.CatMan.Catalogs[uri], latest.Catalogs[uri]) {
+			change.Action = "updated"
+		}
+		plan.Catalogs = append(plan.Catalogs, change)
+	}
+
+	plan.catalogs = latest
+	advisories := fm.Advisories(latest)
+	plan.installed = map[string]FunctionDefinition{}
+	plan.Functions = []FunctionChange{}
+	for _, groupName := range groupNames {
+		oldFn := fm.Installed[groupName]
+		change := FunctionChange{
+			Function:  groupName,
+			Action:    "unchanged",
+			From:      oldFn.Versions[0].Name,
+			FromImage: oldFn.Versions[0].Runtime.Container.Image,
+			Pinned:    IsPinned(oldFn),
+		}
+
+		requirement := Requirement(oldFn)
+		if opts.To != "" {
+			requirement = groupName + "@" + opts.To
+		}
+		_, _, version := ToGroupNameVersion(requirement)
+
+		newFn, err := latest.SearchExact(requirement)
+		if err == nil {
+			newFn, err = SelectVersion(newFn, version)
+		}
+		if err != nil && opts.To != "" {
+			return plan, err
+		}
+		if errors.Is(err, ErrYanked) {
+			change.Action = "yanked"
+			change.Error = err.Error()
+			change.Warnings = []string{fmt.Sprintf("WARNING: %v, it stays at %s", err, change.From)}
+			plan.Functions = append(plan.Functions, change)
+			continue
+		}
+		if err != nil {
+			change.Action = "missing"
+			plan.Functions = append(plan.Functions, change)
+			continue
+		}
+		change.Pinned = IsPinned(newFn)
+
+		change.To = newFn.Versions[0].Name
+		change.ToImage = newFn.Versions[0].Runtime.Container.Image
+		change.Warnings = LifecycleWarnings(latest, groupName, change.To, change.From == change.To)
+		switch cmp := CompareVersions(change.From, change.To); {
+		case cmp < 0:
+			change.Action = "upgrade"
+			change.Major = isMajorBump(change.From, change.To)
+		case cmp > 0:
+			change.Action = "downgrade"
+		case !reflect.DeepEqual(oldFn.Versions[0].Runtime, newFn.Versions[0].Runtime):
+			change.Action = "changed"
+		case Requirement(oldFn) != Requirement(newFn):
+			change.Action = "repinned"
+		}
+
+		if change.Action != "unchanged" {
+			if err := fm.Policy.Check(newFn); err != nil {
+				change.Action = "blocked"
+				change.Error = err.Error()
+			} else {
+				plan.installed[groupName] = newFn
+				change.Advisories = AffectedBy(advisories, groupName, change.To)
+			}
+		}
+		plan.Functions = append(plan.Functions, change)
+	}
+	fm.blockBrokenDependencies(&plan, advisories)
+
+	return plan, nil
+}
+
+// Adds the new dependencies of the versions functions move to, and blocks the
+// changes that would leave a function without a dependency it accepts, either
+// because no version of it fits or because the dependency moves away.
+// Problems that are already there are left alone. Blocking one change can
+// break another, so this goes on until nothing changes.
+func (fm *FunctionManager) blockBrokenDependencies(plan *UpdatePlan, advisories []Advisory) {
+	existing := map[dependencyProblem]bool{}
+	for _, p := range dependencyProblems(fm.Installed) {
+		existing[dependencyProblem{Function: p.Function, Dependency: p.Dependency}] = true
+	}
+	block := func(groupName string, err error) {
+		delete(plan.installed, groupName)
+		for i := range plan.Functions {
+			if change := &plan.Functions[i]; change.Function == groupName {
+				change.Action = "blocked"
+				change.Error = err.Error()
+				change.Advisories = nil
+			}
+		}
+	}
+
+	// Planned functions whose dependencies are left to the check below,
+	// because they were already broken
+	unresolved := map[string]bool{}
+	var deps []FunctionDefinition
+	for blocked := true; blocked; {
+		blocked = false
+		after := maps.Clone(fm.Installed)
+		for groupName, fn := range plan.installed {
+			after[groupName] = fn
+		}
+
+		names := maps.Keys(plan.installed)
+		sort.Strings(names)
+		var requested []FunctionDefinition
+		for _, groupName := range names {
+			if !unresolved[groupName] {
+				requested = append(requested, plan.installed[groupName])
+			}
+		}
+		var err error
+		if deps, err = solveDependencies(plan.catalogs, fm.Policy, after, requested); err != nil {
+			conflict, ok := err.(*DependencyConflict)
+			if !ok || len(conflict.Roots) == 0 {
+				for _, fn := range requested {
+					unresolved[fn.GroupName()] = true
+				}
+			} else {
+				for _, root := range conflict.Roots {
+					if existing[dependencyProblem{Function: root, Dependency: conflict.Function}] {
+						unresolved[root] = true
+					} else {
+						block(root, err)
+					}
+				}
+			}
+			blocked = true
+			continue
+		}
+		for _, dep := range deps {
+			after[dep.GroupName()] = dep
+		}
+
+		for _, p := range dependencyProblems(after) {
+			if existing[dependencyProblem{Function: p.Function, Dependency: p.Dependency}] {
+				continue
+			}
+			culprit := p.Function
+			if _, ok := plan.installed[culprit]; !ok {
+				culprit = p.Dependency
+			}
+			if _, ok := plan.installed[culprit]; !ok {
+				continue
+			}
+
+			block(culprit, p.Err)
+			blocked = true
+			break
+		}
+	}
+
+	for _, dep := range deps {
+		groupName, version := dep.GroupName(), dep.Versions[0].Name
+		plan.installed[groupName] = dep
+		plan.Functions = append(plan.Functions, FunctionChange{
+			Function:   groupName,
+			Action:     "added",
+			To:         version,
+			ToImage:    dep.Versions[0].Runtime.Container.Image,
+			Advisories: AffectedBy(advisories, groupName, version),
+			Warnings:   LifecycleWarnings(plan.catalogs, groupName, version, false),
+		})
+	}
+}
+
+// Replaces the catalogs and installed functions with the planned ones. Plans
+// where a catalog failed are refused, so an update is all or nothing.
+func (fm *FunctionManager) ApplyPlan(plan UpdatePlan) error {
+	if err := plan.Err(); err != nil {
+		return err
+	}
+
+	fm.CatMan.swapCatalogs(plan.catalogs)
+
+	for groupName, fn := range plan.installed {
+		fm.Installed[groupName] = fn
+		fm.dirty = true
+	}
+
+	return nil
+}
+
+// The first catalog that could not be fetched or function the policy
+// blocks, if any
+func (plan UpdatePlan) Err() error {
+	for _, change := range plan.Catalogs {
+		if change.Action == "failed" {
+			return fmt.Errorf("not updating anything: %s", change.Error)
+		}
+	}
+	for _, change := range plan.Functions {
+		if change.Action == "blocked" {
+			return fmt.Errorf("not updating anything: %s", change.Error)
+		}
+	}
+
+	return nil
+}
+
+func (plan UpdatePlan) HasMajorUpgrades() bool {
+	for _, change := range plan.Functions {
+		if change.Major {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (plan UpdatePlan) HasChanges() bool {
+	for _, change := range plan.Catalogs {
+		if change.Action == "updated" {
+			return true
+		}
+	}
+
+	return len(plan.installed) > 0
+}
+
+func (plan UpdatePlan) Header() []string {
+	return []string{"NAME", "KIND", "CHANGE", "FROM", "TO"}
+}
+
+func (plan UpdatePlan) Rows() (rows [][]string) {
+	for _, x := range plan.Catalogs {
+		rows = append(rows, []string{x.Catalog, "catalog", x.Action, "", ""})
+	}
+
+	for _, x := range plan.Functions {
+		action := x.Action
+		if x.Major {
+			action += " (major)"
+		}
+		if x.Pinned {
+			action += " (pinned)"
+		}
+
+		from, to := x.From, x.To
+		if x.Action == "changed" {
+			from, to = x.FromImage, x.ToImage
+		}
+		rows = append(rows, []string{x.Function, "function", action, from, to})
+	}
+
+	return
+}
+
+func isMajorBump(from, to string) bool {
+	x, okFrom := ParseSemver(from)
+	y, okTo := ParseSemver(to)
+
+	return okFrom && okTo && y.Major > x.Major
+}
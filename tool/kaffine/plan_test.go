@@ -0,0 +1,273 @@
+package kaffine
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPlanUpdateYanked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + path
+	writeHistoryCatalog(t, path, "v1.0.0")
+
+	runHistoryCommand(t, dir, "install", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog(uri); err != nil {
+			return err
+		}
+		_, err := fm.AddFunctionDefinitions([]string{"example.com/Logger"}, false)
+		return err
+	})
+
+	logger := makeDependencyFunction("Logger", map[string][]FunctionDependency{"v1.0.0": nil, "v1.1.0": nil})
+	logger.Yanked = true
+	writeCatalog(t, path, logger)
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	plan, err := fm.PlanUpdate(UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := plan.Functions[0]
+	if change.Action != "yanked" || !strings.Contains(change.Error, "yanked") {
+		t.Errorf("got %s (%s), want yanked", change.Action, change.Error)
+	}
+	if len(change.Warnings) == 0 {
+		t.Errorf("no warning that %s stays at %s", change.Function, change.From)
+	}
+	if err = plan.Err(); err != nil {
+		t.Errorf("a yanked function should not block the update: %v", err)
+	}
+	if _, ok := plan.installed[change.Function]; ok {
+		t.Errorf("%s should stay at %s", change.Function, change.From)
+	}
+}
+
+// Installs fnames from a catalog with fns, then plans an update against one
+// with updated
+func planTestUpdate(t *testing.T, fnames []string, fns []FunctionDefinition, updated []FunctionDefinition, opts UpdateOptions) (UpdatePlan, error) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "catalog.yaml")
+	writeCatalog(t, path, fns...)
+
+	runHistoryCommand(t, dir, "install", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog("file://" + path); err != nil {
+			return err
+		}
+		_, err := fm.AddFunctionDefinitions(fnames, false)
+		return err
+	})
+	writeCatalog(t, path, updated...)
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	return fm.PlanUpdate(opts)
+}
+
+func planDependencyUpdate(t *testing.T, fnames []string, fns []FunctionDefinition, updated []FunctionDefinition) UpdatePlan {
+	plan, err := planTestUpdate(t, fnames, fns, updated, UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return plan
+}
+
+// A Logger with an image for each version
+func makeImageFunction(images map[string]string) FunctionDefinition {
+	fd := makeDependencyFunction("Logger", map[string][]FunctionDependency{})
+	for name, image := range images {
+		v := FunctionVersion{Name: name}
+		v.Runtime.Container.Image = image
+		fd.Versions = append(fd.Versions, v)
+	}
+	sort.Slice(fd.Versions, func(i, j int) bool {
+		return CompareVersions(fd.Versions[i].Name, fd.Versions[j].Name) < 0
+	})
+
+	return fd
+}
+
+func TestPlanUpdate(t *testing.T) {
+	v1 := makeImageFunction(map[string]string{"v1.0.0": "logger:1.0"})
+	v2 := makeImageFunction(map[string]string{"v2.0.0": "logger:2.0"})
+	minor := makeImageFunction(map[string]string{"v1.0.0": "logger:1.0", "v1.1.0": "logger:1.1"})
+	major := makeImageFunction(map[string]string{"v1.0.0": "logger:1.0", "v1.1.0": "logger:1.1", "v2.0.0": "logger:2.0"})
+	rebuilt := makeImageFunction(map[string]string{"v1.0.0": "logger:1.0-rebuilt"})
+	other := makeDependencyFunction("Other", map[string][]FunctionDependency{"v1.0.0": nil})
+	logger := []string{"Logger"}
+	pinned := []string{"Logger@v1.0.0"}
+
+	var tests = []struct {
+		name    string
+		install []string
+		before  FunctionDefinition
+		after   FunctionDefinition
+		opts    UpdateOptions
+		action  string
+		to      string
+		major   bool
+		pinned  bool
+	}{
+		{"upgrade", logger, v1, minor, UpdateOptions{}, "upgrade", "v1.1.0", false, false},
+		{"major upgrade", logger, v1, major, UpdateOptions{}, "upgrade", "v2.0.0", true, false},
+		{"downgrade", logger, v2, v1, UpdateOptions{}, "downgrade", "v1.0.0", false, false},
+		{"changed", logger, v1, rebuilt, UpdateOptions{}, "changed", "v1.0.0", false, false},
+		{"unchanged", logger, v1, v1, UpdateOptions{}, "unchanged", "v1.0.0", false, false},
+		{"missing", logger, v1, other, UpdateOptions{}, "missing", "", false, false},
+		{"pinned", pinned, v1, major, UpdateOptions{}, "unchanged", "v1.0.0", false, true},
+		{"repinned", pinned, v1, v1, UpdateOptions{Functions: logger, To: "^1"}, "repinned", "v1.0.0", false, false},
+		{"pin moved by --to", pinned, v1, major, UpdateOptions{Functions: logger, To: "v1.1.0"}, "upgrade", "v1.1.0", false, true},
+		{"pin replaced by a constraint", pinned, v1, major, UpdateOptions{Functions: logger, To: "^1"}, "upgrade", "v1.1.0", false, false},
+	}
+
+	for _, test := range tests {
+		plan, err := planTestUpdate(t, test.install, []FunctionDefinition{test.before}, []FunctionDefinition{test.after}, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		change := plan.Functions[0]
+		if change.Action != test.action || change.To != test.to || change.Major != test.major || change.Pinned != test.pinned {
+			t.Errorf("%s: expected %s to %s (major %v, pinned %v), got %s to %s (major %v, pinned %v)", test.name,
+				test.action, test.to, test.major, test.pinned, change.Action, change.To, change.Major, change.Pinned)
+		}
+		if plan.HasMajorUpgrades() != test.major {
+			t.Errorf("%s: expected HasMajorUpgrades %v", test.name, test.major)
+		}
+	}
+}
+
+func planActions(plan UpdatePlan) map[string]string {
+	actions := map[string]string{}
+	for _, change := range plan.Functions {
+		actions[change.Function] = change.Action + " " + change.To
+	}
+
+	return actions
+}
+
+func TestPlanUpdateAddsDependencies(t *testing.T) {
+	app := makeDependencyFunction("App", map[string][]FunctionDependency{"v1.0.0": nil})
+	updated := makeDependencyFunction("App", map[string][]FunctionDependency{
+		"v1.0.0": nil,
+		"v2.0.0": {{Name: "Sidecar", Version: "^1"}},
+	})
+	sidecar := makeDependencyFunction("Sidecar", map[string][]FunctionDependency{"v1.0.0": nil, "v1.1.0": nil, "v2.0.0": nil})
+
+	plan := planDependencyUpdate(t, []string{"App"}, []FunctionDefinition{app}, []FunctionDefinition{updated, sidecar})
+	want := map[string]string{"example.com/App": "upgrade v2.0.0", "example.com/Sidecar": "added v1.1.0"}
+	if got := planActions(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if err := plan.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlanUpdateBlockedByDependency(t *testing.T) {
+	base := makeDependencyFunction("Base", map[string][]FunctionDependency{"v1.0.0": nil})
+	tool := makeDependencyFunction("Tool", map[string][]FunctionDependency{
+		"v1.0.0": {{Name: "Base", Version: "^1"}},
+	})
+	app := makeDependencyFunction("App", map[string][]FunctionDependency{"v1.0.0": nil})
+	updatedBase := makeDependencyFunction("Base", map[string][]FunctionDependency{"v1.0.0": nil, "v2.0.0": nil})
+	updatedApp := makeDependencyFunction("App", map[string][]FunctionDependency{
+		"v1.0.0": nil,
+		"v2.0.0": {{Name: "Base", Version: "^2"}},
+	})
+
+	// Tool keeps Base at v1, and App v2 needs Base v2
+	plan := planDependencyUpdate(t, []string{"Base", "Tool", "App"}, []FunctionDefinition{base, tool, app}, []FunctionDefinition{updatedBase, tool, updatedApp})
+	want := map[string]string{
+		"example.com/App":  "blocked v2.0.0",
+		"example.com/Base": "blocked v2.0.0",
+		"example.com/Tool": "unchanged v1.0.0",
+	}
+	if got := planActions(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if plan.Err() == nil || len(plan.installed) != 0 {
+		t.Errorf("expected the update to be blocked, got %v", plan.installed)
+	}
+}
+
+func TestPlanUpdateToNeedsOneFunction(t *testing.T) {
+	logger := makeImageFunction(map[string]string{"v1.0.0": "logger:1.0"})
+	other := makeDependencyFunction("Other", map[string][]FunctionDependency{"v1.0.0": nil})
+	fns := []FunctionDefinition{logger, other}
+
+	for _, functions := range [][]string{nil, {"Logger", "Other"}} {
+		_, err := planTestUpdate(t, []string{"Logger", "Other"}, fns, fns, UpdateOptions{Functions: functions, To: "v1.0.0"})
+		if err == nil {
+			t.Errorf("--to with functions %v: expected an error", functions)
+		}
+	}
+}
+
+func TestPlanUpdateOnlyGivenCatalogs(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.yaml"), filepath.Join(dir, "second.yaml")
+	other := makeDependencyFunction("Other", map[string][]FunctionDependency{"v1.0.0": nil})
+	writeHistoryCatalog(t, first, "v1.0.0")
+	writeCatalog(t, second, other)
+
+	runHistoryCommand(t, dir, "install", func(fm *FunctionManager) error {
+		if err := fm.CatMan.AddCatalog("file://" + first); err != nil {
+			return err
+		}
+		if err := fm.CatMan.AddCatalog("file://" + second); err != nil {
+			return err
+		}
+		_, err := fm.AddFunctionDefinitions([]string{"Logger", "Other"}, false)
+		return err
+	})
+	writeHistoryCatalog(t, first, "v1.1.0")
+	writeCatalog(t, second, makeDependencyFunction("Other", map[string][]FunctionDependency{"v1.0.0": nil, "v1.1.0": nil}))
+
+	fm, err := NewFunctionManager(dir, SharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	plan, err := fm.PlanUpdate(UpdateOptions{Catalogs: []string{"file://" + second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var catalogs []string
+	for _, change := range plan.Catalogs {
+		catalogs = append(catalogs, filepath.Base(change.Catalog)+" "+change.Action)
+	}
+	if want := []string{"first.yaml unchanged", "second.yaml updated"}; !reflect.DeepEqual(catalogs, want) {
+		t.Errorf("expected catalogs %v, got %v", want, catalogs)
+	}
+	want := map[string]string{"example.com/Logger": "unchanged v1.0.0", "example.com/Other": "upgrade v1.1.0"}
+	if got := planActions(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Named functions only fetch the catalogs they come from
+	if plan, err = fm.PlanUpdate(UpdateOptions{Functions: []string{"Logger"}}); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"example.com/Logger": "upgrade v1.1.0"}
+	if got := planActions(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if plan.Catalogs[1].Action != "unchanged" {
+		t.Errorf("expected %s not to be fetched", plan.Catalogs[1].Catalog)
+	}
+}
@@ -0,0 +1,140 @@
+package kaffine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Rules for what may be installed, read from policy.yaml in the kaffine
+// directory. Without the file anything goes. With it, each rule only applies
+// when set.
+type Policy struct {
+	FilePath string `json:"-"`
+
+	// Container images must come from one of these, either a registry like
+	// gcr.io or a registry and path like gcr.io/kpt-fn
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// Every container image and exec binary must have a sha256
+	RequireSha256 bool `json:"requireSha256,omitempty"`
+	// Only the functions in AllowNetwork may set requireNetwork
+	RestrictNetwork bool `json:"restrictNetwork,omitempty"`
+	// Functions, as group/Kind
+	AllowNetwork []string `json:"allowNetwork,omitempty"`
+	// Only the functions in AllowStorageMount may set requireStorageMount
+	RestrictStorageMount bool `json:"restrictStorageMount,omitempty"`
+	// Functions, as group/Kind
+	AllowStorageMount []string `json:"allowStorageMount,omitempty"`
+	// Compared as SPDX identifiers, so Apache-2.0 also allows "Apache 2.0"
+	AllowedLicenses   []string `json:"allowedLicenses,omitempty"`
+	AllowedPublishers []string `json:"allowedPublishers,omitempty"`
+}
+
+// Reads the policy in directory, or nil if there is none
+func LoadPolicy(directory string) (*Policy, error) {
+	filePath := filepath.Join(directory, "policy.yaml")
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err = yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("policy '%s': %v", filePath, err)
+	}
+	policy.FilePath = filePath
+
+	return policy, nil
+}
+
+// Every rule a function broke
+type PolicyViolation struct {
+	Policy   string
+	Function string
+	Version  string
+	Rules    []string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("%s@%s is not allowed by %s:\n  - %s", v.Function, v.Version, v.Policy, strings.Join(v.Rules, "\n  - "))
+}
+
+// Checks the version fd would install, its only or highest one. A nil policy
+// allows everything.
+func (p *Policy) Check(fd FunctionDefinition) error {
+	if p == nil || len(fd.Versions) == 0 {
+		return nil
+	}
+
+	v := fd.Versions[0]
+	if len(fd.Versions) > 1 {
+		v = fd.GetHighestVersion()
+	}
+	violation := &PolicyViolation{Policy: p.FilePath, Function: fd.GroupName(), Version: v.Name}
+	broke := func(format string, a ...interface{}) {
+		violation.Rules = append(violation.Rules, fmt.Sprintf(format, a...))
+	}
+
+	container := v.Runtime.Container
+	if container.Image != "" {
+		if len(p.AllowedRegistries) > 0 && !allowedRegistry(container.Image, p.AllowedRegistries) {
+			broke("allowedRegistries: image '%s' is not from %s", container.Image, strings.Join(p.AllowedRegistries, ", "))
+		}
+		if p.RequireSha256 && container.Sha256 == "" {
+			broke("requireSha256: image '%s' has no sha256", container.Image)
+		}
+		if p.RestrictNetwork && container.RequireNetwork && !containsFold(p.AllowNetwork, fd.GroupName()) {
+			broke("allowNetwork: the function requires network access but is not in allowNetwork")
+		}
+		if p.RestrictStorageMount && container.RequireStorageMount && !containsFold(p.AllowStorageMount, fd.GroupName()) {
+			broke("allowStorageMount: the function requires a storage mount but is not in allowStorageMount")
+		}
+	}
+	if p.RequireSha256 {
+		for _, platform := range v.Runtime.Exec.Platforms {
+			if platform.Sha256 == "" {
+				broke("requireSha256: exec binary for %s/%s has no sha256", platform.Os, platform.Arch)
+			}
+		}
+	}
+
+	if len(p.AllowedLicenses) > 0 && !licenseAllowed(p.AllowedLicenses, v.License) {
+		broke("allowedLicenses: license '%s' is not one of %s", v.License, strings.Join(p.AllowedLicenses, ", "))
+	}
+	if len(p.AllowedPublishers) > 0 && !containsFold(p.AllowedPublishers, fd.Publisher) {
+		broke("allowedPublishers: publisher '%s' is not one of %s", fd.Publisher, strings.Join(p.AllowedPublishers, ", "))
+	}
+
+	if len(violation.Rules) > 0 {
+		return violation
+	}
+
+	return nil
+}
+
+// Whether image comes from one of the registries. Images without a registry
+// host are on docker.io.
+func allowedRegistry(image string, registries []string) bool {
+	first, rest, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		image = "docker.io/" + image
+	} else if first == "index.docker.io" {
+		image = "docker.io/" + rest
+	}
+
+	for _, registry := range registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if strings.HasPrefix(image, registry+"/") {
+			return true
+		}
+	}
+
+	return false
+}
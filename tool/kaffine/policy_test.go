@@ -0,0 +1,101 @@
+package kaffine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllowedRegistry(t *testing.T) {
+	var tests = []struct {
+		image      string
+		registries []string
+		allowed    bool
+	}{
+		{"gcr.io/kpt-fn/set-labels:v0.1", []string{"gcr.io"}, true},
+		{"gcr.io/kpt-fn/set-labels:v0.1", []string{"gcr.io/kpt-fn"}, true},
+		{"gcr.io/kpt-fn/set-labels:v0.1", []string{"gcr.io/kpt-fn/"}, true},
+		{"gcr.io/other/set-labels:v0.1", []string{"gcr.io/kpt-fn"}, false},
+		{"gcr.io.evil.com/kpt-fn/set-labels", []string{"gcr.io"}, false},
+		{"nginx:latest", []string{"docker.io"}, true},
+		{"library/nginx", []string{"docker.io/library"}, true},
+		{"index.docker.io/library/nginx", []string{"docker.io"}, true},
+		{"localhost/fn", []string{"localhost"}, true},
+		{"localhost:5000/fn", []string{"localhost:5000"}, true},
+		{"nginx", []string{"gcr.io"}, false},
+	}
+
+	for _, test := range tests {
+		if allowed := allowedRegistry(test.image, test.registries); allowed != test.allowed {
+			t.Errorf("allowedRegistry(%q, %v) = %v, want %v", test.image, test.registries, allowed, test.allowed)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	fd := FunctionDefinition{Group: "example.com", Publisher: "Example"}
+	fd.Names.Kind = "Logger"
+	v := FunctionVersion{Name: "v1.0.0", License: "Apache-2.0"}
+	v.Runtime.Container = FunctionRuntimeContainer{Image: "gcr.io/kpt-fn/logger:v1", Sha256: "abc"}
+	v.Runtime.Exec.Platforms = []FunctionRuntimePlatform{{Os: "linux", Arch: "amd64", Sha256: "def"}}
+	fd.Versions = []FunctionVersion{v}
+
+	withContainer := func(c FunctionRuntimeContainer) FunctionDefinition {
+		fd := fd
+		fd.Versions = []FunctionVersion{v}
+		fd.Versions[0].Runtime.Container = c
+		return fd
+	}
+	noExecSha := fd
+	noExecSha.Versions = []FunctionVersion{v}
+	noExecSha.Versions[0].Runtime.Exec.Platforms = []FunctionRuntimePlatform{{Os: "linux", Arch: "arm64"}}
+
+	var tests = []struct {
+		name   string
+		policy *Policy
+		fd     FunctionDefinition
+		// Rules that must be broken, none means allowed
+		rules []string
+	}{
+		{"no policy", nil, withContainer(FunctionRuntimeContainer{Image: "evil.com/x", RequireNetwork: true}), nil},
+		{"empty policy", &Policy{}, fd, nil},
+		{"registry", &Policy{AllowedRegistries: []string{"gcr.io/kpt-fn"}}, fd, nil},
+		{"wrong registry", &Policy{AllowedRegistries: []string{"ghcr.io"}}, fd, []string{"allowedRegistries"}},
+		{"sha256", &Policy{RequireSha256: true}, fd, nil},
+		{"image without sha256", &Policy{RequireSha256: true}, withContainer(FunctionRuntimeContainer{Image: "gcr.io/x"}), []string{"requireSha256"}},
+		{"exec without sha256", &Policy{RequireSha256: true}, noExecSha, []string{"requireSha256"}},
+		{"unrestricted network", &Policy{AllowedLicenses: []string{"Apache-2.0"}}, withContainer(FunctionRuntimeContainer{Image: "gcr.io/x", RequireNetwork: true}), nil},
+		{"network", &Policy{RestrictNetwork: true}, withContainer(FunctionRuntimeContainer{Image: "gcr.io/x", RequireNetwork: true}), []string{"allowNetwork"}},
+		{"allowed network", &Policy{RestrictNetwork: true, AllowNetwork: []string{"example.com/logger"}}, withContainer(FunctionRuntimeContainer{Image: "gcr.io/x", RequireNetwork: true}), nil},
+		{"unrestricted storage mount", &Policy{RestrictNetwork: true}, withContainer(FunctionRuntimeContainer{Image: "gcr.io/x", RequireStorageMount: true}), nil},
+		{"storage mount", &Policy{RestrictStorageMount: true, AllowNetwork: []string{"example.com/Logger"}}, withContainer(FunctionRuntimeContainer{Image: "gcr.io/x", RequireStorageMount: true}), []string{"allowStorageMount"}},
+		{"license", &Policy{AllowedLicenses: []string{"MIT", "apache-2.0"}}, fd, nil},
+		{"wrong license", &Policy{AllowedLicenses: []string{"MIT"}}, fd, []string{"allowedLicenses"}},
+		{"wrong publisher", &Policy{AllowedPublishers: []string{"Other"}}, fd, []string{"allowedPublishers"}},
+		{"several rules", &Policy{AllowedLicenses: []string{"MIT"}, AllowedPublishers: []string{"Other"}}, fd, []string{"allowedLicenses", "allowedPublishers"}},
+	}
+
+	for _, test := range tests {
+		err := test.policy.Check(test.fd)
+		if len(test.rules) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+
+		violation, ok := err.(*PolicyViolation)
+		if !ok {
+			t.Errorf("%s: expected a policy violation, got %v", test.name, err)
+			continue
+		}
+		if len(violation.Rules) != len(test.rules) {
+			t.Errorf("%s: broke %v, want %v", test.name, violation.Rules, test.rules)
+			continue
+		}
+		for i, rule := range test.rules {
+			if !strings.HasPrefix(violation.Rules[i], rule+":") {
+				t.Errorf("%s: rule %d is %q, want %s", test.name, i, violation.Rules[i], rule)
+			}
+		}
+	}
+}
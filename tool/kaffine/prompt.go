@@ -0,0 +1,59 @@
+package kaffine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var Stdin io.Reader = os.Stdin
+var Stderr io.Writer = os.Stderr
+
+// Whether a person can answer prompts, i.e. stdin is a terminal
+func Interactive() bool {
+	f, ok := Stdin.(*os.File)
+
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Asks a yes/no question on stderr. Anything but yes is a no.
+func Confirm(question string) (bool, error) {
+	fmt.Fprintf(Stderr, "%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// Asks to pick one of the options by number on stderr, returning its index
+func Choose(question string, options []string) (int, error) {
+	fmt.Fprintln(Stderr, question)
+	for i, option := range options {
+		fmt.Fprintf(Stderr, "  %d) %s\n", i+1, option)
+	}
+
+	reader := bufio.NewReader(Stdin)
+	for {
+		fmt.Fprintf(Stderr, "Enter a number [1-%d]: ", len(options))
+
+		answer, err := reader.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(answer)); convErr == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		if err == io.EOF {
+			return -1, fmt.Errorf("no option picked")
+		}
+		if err != nil {
+			return -1, err
+		}
+	}
+}
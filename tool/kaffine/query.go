@@ -0,0 +1,197 @@
+package kaffine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// What `search` looks for. Empty fields match everything.
+type SearchQuery struct {
+	// Part of the group/name, optionally with @version
+	Name string
+	// All of them must be present
+	Tags      []string
+	Publisher string
+	License   string
+	// "exec" or "container"
+	Runtime string
+	// Words that must all appear in the name, description, tags or usage, as
+	// a whole word or the start of one
+	Text string
+	// Platform an exec runtime must be available for
+	Os   string
+	Arch string
+}
+
+func (q SearchQuery) Validate() error {
+	switch q.Runtime {
+	case "", "exec", "container":
+	default:
+		return fmt.Errorf("unknown runtime '%s', expected exec or container", q.Runtime)
+	}
+
+	return nil
+}
+
+// Functions that match the query, most relevant first. Only the versions that
+// match are kept.
+func (cm *CatalogManager) Query(q SearchQuery) (fns []FunctionDefinition, err error) {
+	if err = q.Validate(); err != nil {
+		return nil, err
+	}
+
+	candidates, textScores := cm.queryCandidates(q)
+	scores := map[string]int{}
+	for _, fn := range candidates {
+		match, score, ok := q.match(fn)
+		if !ok {
+			continue
+		}
+		fns = append(fns, match)
+		scores[match.GroupName()] = score + textScores[match.GroupName()]
+	}
+
+	sort.SliceStable(fns, func(i, j int) bool {
+		a, b := fns[i].GroupName(), fns[j].GroupName()
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return a < b
+	})
+
+	return fns, nil
+}
+
+// The functions to check the rest of the query against, and how well they
+// match its text. The name and text are looked up in the index, so before Load
+// only the catalogs with a hit are parsed.
+func (cm *CatalogManager) queryCandidates(q SearchQuery) (candidates map[string]FunctionDefinition, textScores map[string]int) {
+	if !cm.loaded {
+		cm.loadIndex()
+	}
+	hasText := len(tokenize(q.Text)) > 0
+	if hasText {
+		textScores = cm.Index.Lookup(q.Text)
+	}
+	hit := func(groupName string) bool {
+		if _, ok := textScores[groupName]; hasText && !ok {
+			return false
+		}
+		return q.Name == "" || matchesName(groupName, q.Name, true)
+	}
+
+	candidates = map[string]FunctionDefinition{}
+	if !cm.loaded {
+		if sources, ok := cm.indexedSources(); ok {
+			for groupName := range sources {
+				if !hit(groupName) {
+					continue
+				}
+				if fn, ok := cm.Function(groupName); ok {
+					candidates[groupName] = fn
+				}
+			}
+			return candidates, textScores
+		}
+	}
+
+	cm.Load()
+	for groupName, fn := range cm.Functions {
+		if hit(groupName) {
+			candidates[groupName] = fn
+		}
+	}
+
+	return candidates, textScores
+}
+
+// Whether fn matches, and if so fn with the matching versions and how
+// relevant it is
+func (q SearchQuery) match(fn FunctionDefinition) (match FunctionDefinition, score int, ok bool) {
+	match = fn
+
+	if q.Name != "" {
+		if match, ok = searchMatch(fn, q.Name, true); !ok {
+			return
+		}
+		score += q.nameScore(fn)
+	}
+
+	for _, tag := range q.Tags {
+		if !containsFold(fn.Tags, tag) {
+			return match, 0, false
+		}
+	}
+
+	if q.Publisher != "" && !strings.Contains(strings.ToLower(fn.Publisher), strings.ToLower(q.Publisher)) {
+		return match, 0, false
+	}
+
+	var versions []FunctionVersion
+	for _, v := range match.Versions {
+		if q.matchVersion(v) {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return match, 0, false
+	}
+	match.Versions = versions
+
+	return match, score, true
+}
+
+func (q SearchQuery) matchVersion(v FunctionVersion) bool {
+	if q.License != "" && !strings.EqualFold(v.License, q.License) {
+		return false
+	}
+
+	switch q.Runtime {
+	case "exec":
+		if len(v.Runtime.Exec.Platforms) == 0 {
+			return false
+		}
+	case "container":
+		if v.Runtime.Container.Image == "" {
+			return false
+		}
+	}
+
+	if q.Os == "" && q.Arch == "" {
+		return true
+	}
+	for _, p := range v.Runtime.Exec.Platforms {
+		if (q.Os == "" || strings.EqualFold(p.Os, q.Os)) && (q.Arch == "" || strings.EqualFold(p.Arch, q.Arch)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Exact names rank above prefixes, which rank above other substrings
+func (q SearchQuery) nameScore(fn FunctionDefinition) int {
+	group, name, _ := ToGroupNameVersion(q.Name)
+	kind := strings.ToLower(fn.Names.Kind)
+	name = strings.ToLower(name)
+
+	switch {
+	case kind == name && (group == "" || strings.EqualFold(fn.Group, group)):
+		return 100
+	case strings.HasPrefix(kind, name):
+		return 50
+	default:
+		return 20
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, x := range values {
+		if strings.EqualFold(x, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package kaffine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testQueryCatalog = `apiVersion: config.kubernetes.io/v1alpha1
+kind: Catalog
+spec:
+  krmFunctions:
+  - group: example.com
+    publisher: Example Co
+    description: Adds logging sidecars
+    tags: [logging]
+    names:
+      kind: Logger
+    versions:
+    - name: v1.0.0
+      license: Apache-2.0
+      runtime:
+        container:
+          image: logger:v1.0.0
+  - group: example.com
+    publisher: Other Co
+    description: Sets labels
+    tags: [labels, logging]
+    names:
+      kind: FancyLogger
+    versions:
+    - name: v1.0.0
+      license: MIT
+      usage: Writes fancy log lines
+      runtime:
+        exec:
+          platforms:
+          - bin: fancy
+            os: linux
+            arch: amd64
+`
+
+func TestQuery(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := filepath.Join(dir, "catalog.yaml")
+	os.WriteFile(catalogPath, []byte(testQueryCatalog), 0644)
+
+	cm := MakeCatalogManager(dir)
+	if err := cm.AddCatalog("file://" + catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		q       SearchQuery
+		results []string
+	}{
+		{"everything", SearchQuery{}, []string{"example.com/FancyLogger", "example.com/Logger"}},
+		{"exact name first", SearchQuery{Name: "logger"}, []string{"example.com/Logger", "example.com/FancyLogger"}},
+		{"tags", SearchQuery{Tags: []string{"logging", "Labels"}}, []string{"example.com/FancyLogger"}},
+		{"publisher", SearchQuery{Publisher: "example"}, []string{"example.com/Logger"}},
+		{"license", SearchQuery{License: "apache-2.0"}, []string{"example.com/Logger"}},
+		{"runtime", SearchQuery{Runtime: "container"}, []string{"example.com/Logger"}},
+		{"platform", SearchQuery{Os: "linux", Arch: "arm64"}, nil},
+		{"usage text", SearchQuery{Text: "fancy lines"}, []string{"example.com/FancyLogger"}},
+		{"description text", SearchQuery{Text: "sidecars"}, []string{"example.com/Logger"}},
+	}
+
+	for _, test := range tests {
+		fns, err := cm.Query(test.q)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var names []string
+		for _, fn := range fns {
+			names = append(names, fn.GroupName())
+		}
+		if len(names) != len(test.results) {
+			t.Errorf("%s: got %v, want %v", test.name, names, test.results)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.results[i] {
+				t.Errorf("%s: got %v, want %v", test.name, names, test.results)
+				break
+			}
+		}
+	}
+
+	if _, err := cm.Query(SearchQuery{Runtime: "wasm"}); err == nil {
+		t.Error("expected error for unknown runtime")
+	}
+}
+
+func TestQueryParsesOnlyMatchingCatalogs(t *testing.T) {
+	dir := t.TempDir()
+	loggers, other := filepath.Join(dir, "loggers.yaml"), filepath.Join(dir, "other.yaml")
+	os.WriteFile(loggers, []byte(testQueryCatalog), 0644)
+	writeCatalog(t, other, makeDependencyFunction("Labeler", map[string][]FunctionDependency{"v1.0.0": nil}))
+
+	cm := MakeCatalogManager(dir)
+	for _, path := range []string{loggers, other} {
+		if err := cm.AddCatalog("file://" + path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := cm.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = replaceDir(cm.Directory, files); err != nil {
+		t.Fatal(err)
+	}
+	index, err := cm.Index.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFileAtomic(cm.Index.FilePath, index); err != nil {
+		t.Fatal(err)
+	}
+	// Parsing the other catalog now fails
+	os.WriteFile(filepath.Join(cm.Directory, SHA1("file://"+other)+".yaml"), []byte("spec: ["), 0644)
+
+	for _, q := range []SearchQuery{{Name: "logger"}, {Name: "example.com/Fancy"}, {Text: "fancy"}} {
+		cm = MakeCatalogManager(dir)
+		cm.URIs = []string{"file://" + loggers, "file://" + other}
+
+		fns, err := cm.Query(q)
+		if err != nil || len(fns) == 0 {
+			t.Errorf("%+v: got %d results (%v)", q, len(fns), err)
+		}
+		if cm.Loaded() {
+			t.Errorf("%+v: every catalog was loaded", q)
+		}
+		if _, ok := cm.parsed["file://"+other]; ok {
+			t.Errorf("%+v: parsed a catalog without a match", q)
+		}
+		if source := cm.Source("example.com/Logger"); source != "file://"+loggers {
+			t.Errorf("%+v: got source %s", q, source)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package kaffine
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Outcome of installing, removing or updating a single function
+type FunctionResult struct {
+	Action   string `json:"action"`
+	Function string `json:"function"`
+	Version  string `json:"version"`
+	Source   string `json:"source,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (fm *FunctionManager) MakeFunctionResult(action string, fd FunctionDefinition) FunctionResult {
+	r := FunctionResult{Action: action, Function: fd.GroupName(), Source: fm.CatMan.Source(fd.GroupName())}
+	if len(fd.Versions) > 0 {
+		r.Version = fd.Versions[0].Name
+	}
+
+	return r
+}
+
+func (r FunctionResult) Header() []string {
+	return FunctionResults{}.Header()
+}
+
+func (r FunctionResult) Rows() [][]string {
+	return FunctionResults{r}.Rows()
+}
+
+type FunctionResults []FunctionResult
+
+func (r FunctionResults) Header() []string {
+	return []string{"FUNCTION", "ACTION", "VERSION", "SOURCE"}
+}
+
+func (r FunctionResults) Rows() (rows [][]string) {
+	for _, x := range r {
+		rows = append(rows, []string{x.Function, x.Action, x.Version, x.Source})
+	}
+
+	return
+}
+
+// Errors of the functions that failed, one per function
+func (r FunctionResults) Errors() (errs []error) {
+	for _, x := range r {
+		if x.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", x.Function, x.Error))
+		}
+	}
+
+	return
+}
+
+// Outcome of adding, removing or updating a single catalog
+type CatalogResult struct {
+	Action  string `json:"action"`
+	Catalog string `json:"catalog"`
+}
+
+func (r CatalogResult) Header() []string {
+	return []string{"CATALOG", "ACTION"}
+}
+
+func (r CatalogResult) Rows() [][]string {
+	return [][]string{{r.Catalog, r.Action}}
+}
+
+// A row of `list` or `search`
+type FunctionListItem struct {
+	Function    string `json:"function"`
+	Version     string `json:"version"`
+	Catalog     string `json:"catalog,omitempty"`
+	Installed   bool   `json:"installed"`
+	Pinned      bool   `json:"pinned"`
+	Constraint  string `json:"constraint,omitempty"`
+	Description string `json:"description,omitempty"`
+	// deprecated or yanked, going by the catalog
+	Status string `json:"status,omitempty"`
+}
+
+type FunctionList struct {
+	Items []FunctionListItem `json:"items"`
+}
+
+// Installed functions use their installed version, others their highest
+func (fm *FunctionManager) MakeFunctionList(fds []FunctionDefinition) (fl FunctionList) {
+	fl.Items = []FunctionListItem{}
+	for _, fd := range fds {
+		item := FunctionListItem{
+			Function:    fd.GroupName(),
+			Catalog:     fm.CatMan.Source(fd.GroupName()),
+			Description: fd.Description,
+		}
+		if installed, ok := fm.Installed[fd.GroupName()]; ok {
+			fd = installed
+			item.Installed = true
+			item.Pinned = IsPinned(installed)
+			item.Constraint = GetVersionConstraint(installed)
+		}
+		if len(fd.Versions) > 0 {
+			item.Version = fd.GetHighestVersion().Name
+		}
+		if catalogFd, ok := fm.CatMan.Function(fd.GroupName()); ok {
+			item.Status = LifecycleStatus(catalogFd, item.Version)
+		}
+		fl.Items = append(fl.Items, item)
+	}
+
+	return
+}
+
+func (fl FunctionList) Header() []string {
+	return []string{"FUNCTION", "VERSION", "CATALOG", "PINNED", "STATUS"}
+}
+
+func (fl FunctionList) Rows() (rows [][]string) {
+	for _, x := range fl.Items {
+		pinned := ""
+		if x.Constraint != "" {
+			pinned = x.Constraint
+		} else if x.Installed {
+			pinned = strconv.FormatBool(x.Pinned)
+		}
+		rows = append(rows, []string{x.Function, x.Version, x.Catalog, pinned, x.Status})
+	}
+
+	return
+}
+
+type ConfigResult struct {
+	Catalogs     []string `json:"catalogs"`
+	KrmFunctions []string `json:"krmFunctions"`
+}
+
+func (r ConfigResult) Header() []string {
+	return []string{"NAME", "KIND"}
+}
+
+func (r ConfigResult) Rows() (rows [][]string) {
+	for _, x := range r.Catalogs {
+		rows = append(rows, []string{x, "catalog"})
+	}
+	for _, x := range r.KrmFunctions {
+		rows = append(rows, []string{x, "function"})
+	}
+
+	return
+}
+
+type VersionResult struct {
+	Version string `json:"version"`
+}
+
+func (r VersionResult) Describe(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "Kaffine version %s\n", r.Version)
+	return err
+}
@@ -0,0 +1,363 @@
+package kaffine
+
+import (
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+var SBOMFormats = []string{"cyclonedx", "spdx"}
+
+// An installed function and the catalog it came from
+type sbomFunction struct {
+	FunctionDefinition
+	Version FunctionVersion
+	Catalog string
+}
+
+// What makes one SBOM differ from the next for the same functions
+type sbomInfo struct {
+	Name      string
+	Timestamp time.Time
+	UUID      string
+}
+
+// Describes the installed functions as a CycloneDX 1.5 or SPDX 2.3 document,
+// ready to be written as JSON
+func (fm *FunctionManager) SBOM(format string) (interface{}, error) {
+	var functions []sbomFunction
+	for _, groupName := range fm.InstalledNames() {
+		fd := fm.Installed[groupName]
+		f := sbomFunction{FunctionDefinition: fd, Catalog: fm.CatMan.Source(groupName)}
+		if len(fd.Versions) > 0 {
+			f.Version = fd.Versions[0]
+		}
+		functions = append(functions, f)
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	info := sbomInfo{
+		Name:      filepath.Base(filepath.Dir(fm.Directory)),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		UUID:      uuid,
+	}
+
+	switch format {
+	case "cyclonedx":
+		return makeCycloneDX(functions, info), nil
+	case "spdx":
+		return makeSPDX(functions, info), nil
+	default:
+		return nil, fmt.Errorf("unknown SBOM format '%s' (expected one of %s)", format, strings.Join(SBOMFormats, "|"))
+	}
+}
+
+// Random, version 4
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// Catalogs write digests with or without the algorithm in front
+func sha256Hex(digest string) string {
+	return strings.TrimPrefix(digest, "sha256:")
+}
+
+type CycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     CycloneDXMetadata    `json:"metadata"`
+	Components   []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []CycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component *CycloneDXComponent `json:"component,omitempty"`
+}
+
+type CycloneDXComponent struct {
+	Type               string               `json:"type"`
+	BOMRef             string               `json:"bom-ref,omitempty"`
+	Group              string               `json:"group,omitempty"`
+	Name               string               `json:"name"`
+	Version            string               `json:"version,omitempty"`
+	Publisher          string               `json:"publisher,omitempty"`
+	Description        string               `json:"description,omitempty"`
+	Licenses           []CycloneDXLicense   `json:"licenses,omitempty"`
+	Hashes             []CycloneDXHash      `json:"hashes,omitempty"`
+	ExternalReferences []CycloneDXReference `json:"externalReferences,omitempty"`
+	Properties         []CycloneDXProperty  `json:"properties,omitempty"`
+	Components         []CycloneDXComponent `json:"components,omitempty"`
+}
+
+// Either a single license, by SPDX id or by name, or an SPDX expression
+type CycloneDXLicense struct {
+	License    *CycloneDXLicenseID `json:"license,omitempty"`
+	Expression string              `json:"expression,omitempty"`
+}
+
+type CycloneDXLicenseID struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type CycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type CycloneDXReference struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type CycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func makeCycloneDX(functions []sbomFunction, info sbomInfo) (bom CycloneDXBOM) {
+	bom.BOMFormat = "CycloneDX"
+	bom.SpecVersion = "1.5"
+	bom.SerialNumber = "urn:uuid:" + info.UUID
+	bom.Version = 1
+	bom.Metadata.Timestamp = info.Timestamp.Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []CycloneDXComponent{{Type: "application", Name: "kaffine", Version: Version}}
+	bom.Metadata.Component = &CycloneDXComponent{Type: "application", Name: info.Name}
+
+	bom.Components = []CycloneDXComponent{}
+	for _, f := range functions {
+		c := CycloneDXComponent{
+			Type:        "application",
+			BOMRef:      f.GroupName() + "@" + f.Version.Name,
+			Group:       f.Group,
+			Name:        f.Names.Kind,
+			Version:     f.Version.Name,
+			Publisher:   f.Publisher,
+			Description: f.Description,
+			Licenses:    cycloneDXLicenses(f.Version.License),
+		}
+		if f.Home != "" {
+			c.ExternalReferences = append(c.ExternalReferences, CycloneDXReference{Type: "website", URL: f.Home})
+		}
+		if f.Catalog != "" {
+			c.ExternalReferences = append(c.ExternalReferences, CycloneDXReference{Type: "distribution", URL: f.Catalog, Comment: "kaffine catalog"})
+		}
+
+		if container := f.Version.Runtime.Container; container.Image != "" {
+			image := CycloneDXComponent{Type: "container", BOMRef: c.BOMRef + "#container", Name: container.Image}
+			if container.Sha256 != "" {
+				image.Hashes = []CycloneDXHash{{Alg: "SHA-256", Content: sha256Hex(container.Sha256)}}
+			}
+			c.Components = append(c.Components, image)
+		}
+		for _, p := range f.Version.Runtime.Exec.Platforms {
+			bin := CycloneDXComponent{
+				Type:    "application",
+				BOMRef:  fmt.Sprintf("%s#exec-%s-%s", c.BOMRef, p.Os, p.Arch),
+				Name:    p.Bin,
+				Version: f.Version.Name,
+				Properties: []CycloneDXProperty{
+					{Name: "kaffine:os", Value: p.Os},
+					{Name: "kaffine:arch", Value: p.Arch},
+				},
+			}
+			if p.Uri != "" {
+				bin.ExternalReferences = []CycloneDXReference{{Type: "distribution", URL: p.Uri}}
+			}
+			if p.Sha256 != "" {
+				bin.Hashes = []CycloneDXHash{{Alg: "SHA-256", Content: sha256Hex(p.Sha256)}}
+			}
+			c.Components = append(c.Components, bin)
+		}
+
+		bom.Components = append(bom.Components, c)
+	}
+
+	return
+}
+
+// A single license by id, or by name when it is not on the SPDX list, and
+// anything else as an expression with LicenseRef-s for unknown licenses
+func cycloneDXLicenses(license string) []CycloneDXLicense {
+	spdx, category := NormalizeLicense(license)
+	expr, refs := SPDXExpression(license)
+	switch {
+	case category == "missing":
+		return nil
+	case expr == "" || (len(refs) == 1 && !strings.Contains(expr, " ")):
+		return []CycloneDXLicense{{License: &CycloneDXLicenseID{Name: strings.TrimSpace(license)}}}
+	case strings.Contains(expr, " "):
+		return []CycloneDXLicense{{Expression: expr}}
+	default:
+		return []CycloneDXLicense{{License: &CycloneDXLicenseID{ID: spdx}}}
+	}
+}
+
+type SPDXDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+	DocumentDescribes []string           `json:"documentDescribes"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Relationships     []SPDXRelationship `json:"relationships"`
+	// The licenses behind the LicenseRef-s in the packages
+	HasExtractedLicensingInfos []SPDXExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+type SPDXExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+	Name          string `json:"name"`
+}
+
+type SPDXPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	Supplier         string            `json:"supplier,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	Homepage         string            `json:"homepage,omitempty"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded,omitempty"`
+	LicenseDeclared  string            `json:"licenseDeclared,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	Checksums        []SPDXChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []SPDXExternalRef `json:"externalRefs,omitempty"`
+}
+
+type SPDXChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func makeSPDX(functions []sbomFunction, info sbomInfo) (doc SPDXDocument) {
+	doc.SPDXVersion = "SPDX-2.3"
+	doc.DataLicense = "CC0-1.0"
+	doc.SPDXID = "SPDXRef-DOCUMENT"
+	doc.Name = info.Name + "-krm-functions"
+	doc.DocumentNamespace = fmt.Sprintf("https://spdx.org/spdxdocs/kaffine-%s-%s", spdxID(info.Name), info.UUID)
+	doc.CreationInfo.Created = info.Timestamp.Format(time.RFC3339)
+	doc.CreationInfo.Creators = []string{"Tool: kaffine-" + Version}
+	doc.DocumentDescribes = []string{}
+	doc.Packages = []SPDXPackage{}
+	doc.Relationships = []SPDXRelationship{}
+
+	extracted := map[string]bool{}
+	contains := func(parent string, p SPDXPackage) {
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, SPDXRelationship{parent, "CONTAINS", p.SPDXID})
+	}
+
+	for _, f := range functions {
+		id := "SPDXRef-Package-" + spdxID(f.GroupName()+"-"+f.Version.Name)
+		p := SPDXPackage{
+			SPDXID:           id,
+			Name:             f.GroupName(),
+			VersionInfo:      f.Version.Name,
+			Supplier:         "NOASSERTION",
+			DownloadLocation: "NOASSERTION",
+			Homepage:         f.Home,
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			Description:      f.Description,
+		}
+		if f.Publisher != "" {
+			p.Supplier = "Organization: " + f.Publisher
+		}
+		if expr, refs := SPDXExpression(f.Version.License); expr != "" {
+			p.LicenseDeclared = expr
+			ids := maps.Keys(refs)
+			sort.Strings(ids)
+			for _, ref := range ids {
+				if !extracted[ref] {
+					extracted[ref] = true
+					doc.HasExtractedLicensingInfos = append(doc.HasExtractedLicensingInfos, SPDXExtractedLicense{ref, refs[ref], refs[ref]})
+				}
+			}
+		}
+		if f.Catalog != "" {
+			p.ExternalRefs = []SPDXExternalRef{{ReferenceCategory: "OTHER", ReferenceType: "kaffine-catalog", ReferenceLocator: f.Catalog}}
+		}
+		doc.Packages = append(doc.Packages, p)
+		doc.DocumentDescribes = append(doc.DocumentDescribes, id)
+		doc.Relationships = append(doc.Relationships, SPDXRelationship{doc.SPDXID, "DESCRIBES", id})
+
+		if container := f.Version.Runtime.Container; container.Image != "" {
+			image := SPDXPackage{
+				SPDXID:           id + "-container",
+				Name:             container.Image,
+				DownloadLocation: "NOASSERTION",
+			}
+			if container.Sha256 != "" {
+				image.Checksums = []SPDXChecksum{{"SHA256", sha256Hex(container.Sha256)}}
+			}
+			contains(id, image)
+		}
+		for _, platform := range f.Version.Runtime.Exec.Platforms {
+			bin := SPDXPackage{
+				SPDXID:           fmt.Sprintf("%s-exec-%s", id, spdxID(platform.Os+"-"+platform.Arch)),
+				Name:             fmt.Sprintf("%s (%s/%s)", platform.Bin, platform.Os, platform.Arch),
+				VersionInfo:      f.Version.Name,
+				DownloadLocation: "NOASSERTION",
+			}
+			if platform.Uri != "" {
+				bin.DownloadLocation = platform.Uri
+			}
+			if platform.Sha256 != "" {
+				bin.Checksums = []SPDXChecksum{{"SHA256", sha256Hex(platform.Sha256)}}
+			}
+			contains(id, bin)
+		}
+	}
+
+	return
+}
+
+// SPDX ids may only have letters, numbers, dots and dashes
+func spdxID(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, s)
+}
@@ -0,0 +1,119 @@
+package kaffine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSBOMFunctions() []sbomFunction {
+	fd := FunctionDefinition{Group: "example.com", Publisher: "Example", Home: "https://example.com/logger"}
+	fd.Names.Kind = "Logger"
+	v := FunctionVersion{Name: "v1.0.0", License: "Apache 2.0"}
+	v.Runtime.Container = FunctionRuntimeContainer{Image: "gcr.io/kpt-fn/logger:v1", Sha256: "sha256:abc"}
+	v.Runtime.Exec.Platforms = []FunctionRuntimePlatform{{Bin: "logger", Os: "linux", Arch: "amd64", Uri: "https://example.com/logger-linux", Sha256: "def"}}
+	fd.Versions = []FunctionVersion{v}
+
+	return []sbomFunction{{FunctionDefinition: fd, Version: v, Catalog: "https://example.com/catalog.yaml"}}
+}
+
+func TestMakeCycloneDX(t *testing.T) {
+	info := sbomInfo{Name: "repo", Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), UUID: "1234"}
+	bom := makeCycloneDX(testSBOMFunctions(), info)
+
+	if bom.SerialNumber != "urn:uuid:1234" || bom.Metadata.Timestamp != "2024-01-02T03:04:05Z" {
+		t.Errorf("unexpected serial number or timestamp: %s %s", bom.SerialNumber, bom.Metadata.Timestamp)
+	}
+	if len(bom.Components) != 1 {
+		t.Fatalf("expected 1 component, got %d", len(bom.Components))
+	}
+
+	c := bom.Components[0]
+	if c.Group != "example.com" || c.Name != "Logger" || c.Version != "v1.0.0" || c.Publisher != "Example" {
+		t.Errorf("unexpected component %+v", c)
+	}
+	if len(c.Licenses) != 1 || c.Licenses[0].License == nil || c.Licenses[0].License.ID != "Apache-2.0" {
+		t.Errorf("expected license Apache-2.0, got %+v", c.Licenses)
+	}
+
+	b, _ := json.Marshal(c)
+	for _, want := range []string{
+		`{"type":"website","url":"https://example.com/logger"}`,
+		`{"type":"distribution","url":"https://example.com/catalog.yaml","comment":"kaffine catalog"}`,
+		`"name":"gcr.io/kpt-fn/logger:v1","hashes":[{"alg":"SHA-256","content":"abc"}]`,
+		`"hashes":[{"alg":"SHA-256","content":"def"}],"externalReferences":[{"type":"distribution","url":"https://example.com/logger-linux"}]`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("component %s does not contain %s", b, want)
+		}
+	}
+}
+
+func TestMakeSPDX(t *testing.T) {
+	info := sbomInfo{Name: "my repo", Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), UUID: "1234"}
+	doc := makeSPDX(testSBOMFunctions(), info)
+
+	if doc.DocumentNamespace != "https://spdx.org/spdxdocs/kaffine-my-repo-1234" {
+		t.Errorf("unexpected namespace %s", doc.DocumentNamespace)
+	}
+	if len(doc.Packages) != 3 || len(doc.Relationships) != 3 {
+		t.Fatalf("expected 3 packages and relationships, got %d and %d", len(doc.Packages), len(doc.Relationships))
+	}
+
+	p := doc.Packages[0]
+	if p.SPDXID != "SPDXRef-Package-example.com-Logger-v1.0.0" || p.LicenseDeclared != "Apache-2.0" || p.Supplier != "Organization: Example" {
+		t.Errorf("unexpected package %+v", p)
+	}
+	if len(p.ExternalRefs) != 1 || p.ExternalRefs[0].ReferenceLocator != "https://example.com/catalog.yaml" {
+		t.Errorf("expected the catalog as external reference, got %+v", p.ExternalRefs)
+	}
+	if doc.Relationships[0] != (SPDXRelationship{"SPDXRef-DOCUMENT", "DESCRIBES", p.SPDXID}) {
+		t.Errorf("unexpected relationship %+v", doc.Relationships[0])
+	}
+
+	bin := doc.Packages[2]
+	if bin.DownloadLocation != "https://example.com/logger-linux" || len(bin.Checksums) != 1 || bin.Checksums[0].ChecksumValue != "def" {
+		t.Errorf("unexpected exec package %+v", bin)
+	}
+	if doc.Relationships[2] != (SPDXRelationship{p.SPDXID, "CONTAINS", bin.SPDXID}) {
+		t.Errorf("unexpected relationship %+v", doc.Relationships[2])
+	}
+}
+
+// Licenses not on the SPDX list must not end up as invalid expressions
+func TestSBOMUnknownLicenses(t *testing.T) {
+	var tests = []struct {
+		license   string
+		cyclonedx CycloneDXLicense
+		declared  string
+		extracted []SPDXExtractedLicense
+	}{
+		{"MIT", CycloneDXLicense{License: &CycloneDXLicenseID{ID: "MIT"}}, "MIT", nil},
+		{"Acme Commercial", CycloneDXLicense{License: &CycloneDXLicenseID{Name: "Acme Commercial"}}, "LicenseRef-Acme-Commercial",
+			[]SPDXExtractedLicense{{"LicenseRef-Acme-Commercial", "Acme Commercial", "Acme Commercial"}}},
+		{"MIT OR Acme Commercial", CycloneDXLicense{Expression: "MIT OR LicenseRef-Acme-Commercial"}, "MIT OR LicenseRef-Acme-Commercial",
+			[]SPDXExtractedLicense{{"LicenseRef-Acme-Commercial", "Acme Commercial", "Acme Commercial"}}},
+		{"Apache 2.0 WITH LLVM-exception", CycloneDXLicense{Expression: "Apache-2.0 WITH LLVM-exception"}, "Apache-2.0 WITH LLVM-exception", nil},
+		{"MIT AND (", CycloneDXLicense{License: &CycloneDXLicenseID{Name: "MIT AND ("}}, "NOASSERTION", nil},
+	}
+
+	for _, test := range tests {
+		functions := testSBOMFunctions()
+		functions[0].Version.License = test.license
+
+		bom := makeCycloneDX(functions, sbomInfo{})
+		if licenses := bom.Components[0].Licenses; len(licenses) != 1 || !reflect.DeepEqual(licenses[0], test.cyclonedx) {
+			t.Errorf("%q: got CycloneDX licenses %+v, want %+v", test.license, licenses, test.cyclonedx)
+		}
+
+		doc := makeSPDX(functions, sbomInfo{})
+		if declared := doc.Packages[0].LicenseDeclared; declared != test.declared {
+			t.Errorf("%q: got licenseDeclared %q, want %q", test.license, declared, test.declared)
+		}
+		if !reflect.DeepEqual(doc.HasExtractedLicensingInfos, test.extracted) {
+			t.Errorf("%q: got extracted licenses %+v, want %+v", test.license, doc.HasExtractedLicensingInfos, test.extracted)
+		}
+	}
+}
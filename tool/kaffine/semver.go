@@ -0,0 +1,268 @@
+package kaffine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A semantic version. Missing minor and patch numbers are treated as 0, so
+// "v3" and "3.0.0" are the same version.
+type Semver struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+func ParseSemver(s string) (v Semver, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		*numbers[i] = n
+	}
+
+	return v, true
+}
+
+func (v Semver) Compare(o Semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	// A prerelease comes before the release itself
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// Compares dot separated identifiers one by one: numeric ones numerically and
+// below alphanumeric ones, which compare as text. A longer prerelease comes
+// after a shorter one it starts with.
+func comparePrerelease(a, b string) int {
+	x, y := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(x) && i < len(y); i++ {
+		n, errX := strconv.Atoi(x[i])
+		m, errY := strconv.Atoi(y[i])
+		switch {
+		case errX == nil && errY == nil:
+			if n != m {
+				if n < m {
+					return -1
+				}
+				return 1
+			}
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		default:
+			if c := strings.Compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	}
+
+	return 0
+}
+
+// Compares version names semantically when both parse, and lexicographically
+// otherwise. Semantic versions sort after everything else.
+func CompareVersions(a, b string) int {
+	x, okA := ParseSemver(a)
+	y, okB := ParseSemver(b)
+
+	switch {
+	case okA && okB:
+		return x.Compare(y)
+	case okA:
+		return 1
+	case okB:
+		return -1
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Whether a version string is a constraint such as "^1.2", ">=1.0.0 <2.0.0"
+// or "1.x", rather than the name of a single version
+func IsConstraint(s string) bool {
+	return strings.ContainsAny(s, "^~<>=*, |") || strings.HasSuffix(s, ".x") || strings.HasSuffix(s, ".X")
+}
+
+type versionComparator struct {
+	op      string
+	version Semver
+}
+
+// Alternatives separated by "||", each made of comparators that must all hold
+type VersionConstraint struct {
+	Source string
+
+	alternatives [][]versionComparator
+}
+
+func ParseConstraint(s string) (c VersionConstraint, err error) {
+	c.Source = s
+	for _, alternative := range strings.Split(s, "||") {
+		var comparators []versionComparator
+		for _, term := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' }) {
+			parsed, err := parseComparator(term)
+			if err != nil {
+				return c, fmt.Errorf("invalid version constraint '%s': %v", s, err)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		if len(comparators) == 0 {
+			return c, fmt.Errorf("invalid version constraint '%s': empty alternative", s)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+
+	return c, nil
+}
+
+func parseComparator(term string) ([]versionComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op = prefix
+			term = term[len(prefix):]
+			break
+		}
+	}
+
+	// Wildcards like 1.x and 1.2.* become ranges
+	parts := strings.Split(strings.TrimPrefix(term, "v"), ".")
+	wildcard := -1
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = i
+			parts = parts[:i]
+			break
+		}
+	}
+	if wildcard == 0 {
+		return []versionComparator{{">=", Semver{}}}, nil
+	}
+
+	v, ok := ParseSemver(strings.Join(parts, "."))
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a semantic version", term)
+	}
+
+	if wildcard > 0 || (op == "" && len(parts) < 3) {
+		op = "~"
+		if len(parts) == 1 {
+			op = "^"
+		}
+	}
+
+	switch op {
+	case "^":
+		upper := Semver{Major: v.Major + 1}
+		if v.Major == 0 {
+			upper = Semver{Minor: v.Minor + 1}
+		}
+		return []versionComparator{{">=", v}, {"<", upper}}, nil
+	case "~":
+		upper := Semver{Major: v.Major, Minor: v.Minor + 1}
+		if len(parts) == 1 {
+			upper = Semver{Major: v.Major + 1}
+		}
+		return []versionComparator{{">=", v}, {"<", upper}}, nil
+	case "":
+		op = "="
+	}
+
+	return []versionComparator{{op, v}}, nil
+}
+
+func (c VersionConstraint) Allows(version string) bool {
+	v, ok := ParseSemver(version)
+	if !ok {
+		return false
+	}
+
+	for _, comparators := range c.alternatives {
+		allowed := true
+		for _, comparator := range comparators {
+			if !comparator.allows(v) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (comparator versionComparator) allows(v Semver) bool {
+	cmp := v.Compare(comparator.version)
+	switch comparator.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	}
+
+	return cmp == 0
+}
+
+// Whether version satisfies a requested version, which is either an exact
+// version name or a constraint
+func MatchesVersion(version string, requested string) bool {
+	if !IsConstraint(requested) {
+		return version == requested
+	}
+
+	c, err := ParseConstraint(requested)
+	if err != nil {
+		return false
+	}
+
+	return c.Allows(version)
+}
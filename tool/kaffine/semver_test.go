@@ -0,0 +1,63 @@
+package kaffine
+
+import (
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want int
+	}{
+		{"v1.0.0", "v1.0.0", 0},
+		{"v3", "v3.0.0", 0},
+		{"v1.0.10", "v1.0.9", 1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v2.0.0", "v10.0.0", -1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-alpha", "v1.0.0-beta", -1},
+		{"v1.0.0-rc.10", "v1.0.0-rc.2", 1},
+		{"v1.0.0-rc.1", "v1.0.0-rc.beta", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0-alpha.beta", "v1.0.0-alpha.1", 1},
+		{"v1.0.0-beta.11", "v1.0.0-beta.2", 1},
+		{"latest", "v1.0.0", -1},
+		{"abc", "abd", -1},
+	}
+
+	for _, test := range tests {
+		if got := CompareVersions(test.a, test.b); got != test.want {
+			t.Errorf("CompareVersions(%s, %s): got %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestMatchesVersion(t *testing.T) {
+	var tests = []struct {
+		version, requested string
+		want               bool
+	}{
+		{"v1.0.0", "v1.0.0", true},
+		{"v1.0.1", "v1.0.0", false},
+		{"v1.4.2", "^1.2", true},
+		{"v2.0.0", "^1.2", false},
+		{"v0.2.5", "^0.2.1", true},
+		{"v0.3.0", "^0.2.1", false},
+		{"v1.2.9", "~1.2.0", true},
+		{"v1.3.0", "~1.2.0", false},
+		{"v1.9.0", ">=1.0.0 <2.0.0", true},
+		{"v2.0.0", ">=1.0.0, <2.0.0", false},
+		{"v3.1.0", "1.x || 3.x", true},
+		{"v2.1.0", "1.x || 3.x", false},
+		{"v1.2.7", "1.2.*", true},
+		{"v1.0.0", "*", true},
+		{"v1.0.0", "!=1.0.0", false},
+		{"nightly", ">=1.0.0", false},
+	}
+
+	for _, test := range tests {
+		if got := MatchesVersion(test.version, test.requested); got != test.want {
+			t.Errorf("MatchesVersion(%s, %s): got %t, want %t", test.version, test.requested, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package kaffine
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Use catalogs whose signature is missing or does not verify, with a warning
+var AllowUnsigned bool
+
+// Signature files sit next to the catalog, with this appended to its uri
+const SignatureSuffix = ".sig"
+
+// Signs catalog data with an ed25519 or ECDSA private key in PEM form. The
+// signature is base64, as it is stored in the .sig file.
+func SignCatalog(data []byte, keyPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("private key is not PEM")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("private key: %v", err)
+	}
+
+	var sig []byte
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, data)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		if sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, expected ed25519 or ECDSA", key)
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// Checks a .sig file against the catalog data. Any one of the public keys, in
+// PEM form, is enough.
+func VerifyCatalog(data []byte, sig []byte, keyPEMs [][]byte) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %v", err)
+	}
+
+	for _, keyPEM := range keyPEMs {
+		key, err := parsePublicKey(keyPEM)
+		if err != nil {
+			return err
+		}
+
+		switch key := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, data, raw) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			digest := sha256.Sum256(data)
+			if ecdsa.VerifyASN1(key, digest[:], raw) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("signature does not match any of the trusted keys")
+}
+
+func parsePublicKey(keyPEM []byte) (interface{}, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("public key is not PEM")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("public key: %v", err)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T, expected ed25519 or ECDSA", key)
+	}
+}
+
+// Kept in the catalog cache next to a catalog that passed verification
+const verifiedSuffix = ".verified"
+
+// Identifies what a catalog has to be signed with: its public keys, or none at
+// all when every catalog has to be signed. Empty when it needs no signature.
+func (cm *CatalogManager) signingFingerprint(uri string) string {
+	keyFiles := cm.Options[uri].PublicKeys
+	if len(keyFiles) == 0 && !cm.RequireSignatures {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, file := range keyFiles {
+		key, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(h, "unreadable %s\n", file)
+			continue
+		}
+		h.Write(key)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Catalogs are verified concurrently by fetchAll. Managers not made by
+// MakeCatalogManager keep no record, which only costs a fetch later.
+func (cm *CatalogManager) setVerified(uri string, fingerprint string) {
+	if cm.verified != nil {
+		cm.verified.Store(uri, fingerprint)
+	}
+}
+
+func (cm *CatalogManager) verifiedWith(uri string) string {
+	if cm.verified == nil {
+		return ""
+	}
+	fingerprint, _ := cm.verified.Load(uri)
+	s, _ := fingerprint.(string)
+
+	return s
+}
+
+// Checks fetched catalog data before it is parsed. Catalogs need a valid
+// signature when they have public keys configured, or when every catalog
+// has to be signed. Catalogs used without one under --allow-unsigned are not
+// marked verified, so the cache does not vouch for them later.
+func (cm *CatalogManager) verifyCatalog(uri string, data []byte) error {
+	fingerprint := cm.signingFingerprint(uri)
+	if fingerprint == "" {
+		return nil
+	}
+
+	err := cm.checkSignature(uri, data, cm.Options[uri].PublicKeys)
+	if err == nil {
+		cm.setVerified(uri, fingerprint)
+		return nil
+	}
+	if !cm.AllowUnsigned {
+		return fmt.Errorf("catalog '%s' failed signature verification: %v", uri, err)
+	}
+
+	fmt.Fprintf(Stderr, "warning: using catalog '%s' without a valid signature (--allow-unsigned): %v\n", uri, err)
+	return nil
+}
+
+func (cm *CatalogManager) checkSignature(uri string, data []byte, keyFiles []string) error {
+	if len(keyFiles) == 0 {
+		return errors.New("no public keys configured for it")
+	}
+
+	var keys [][]byte
+	for _, file := range keyFiles {
+		key, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	u, err := url.ParseRequestURI(uri + SignatureSuffix)
+	if err != nil {
+		return err
+	}
+	sig, err := cm.fetchCatalogData(uri, u)
+	if err != nil {
+		return fmt.Errorf("could not fetch signature: %v", err)
+	}
+
+	return VerifyCatalog(data, sig, keys)
+}
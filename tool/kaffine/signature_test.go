@@ -0,0 +1,178 @@
+package kaffine
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Generates a key pair of the given kind, as PEM
+func generateTestKey(t *testing.T, kind string) (private, public []byte) {
+	var priv, pub interface{}
+	switch kind {
+	case "ed25519":
+		pub, priv, _ = ed25519.GenerateKey(rand.Reader)
+	case "ecdsa":
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		priv, pub = key, &key.PublicKey
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func TestSignAndVerifyCatalog(t *testing.T) {
+	data := []byte(testCatalog)
+
+	for _, kind := range []string{"ed25519", "ecdsa"} {
+		private, public := generateTestKey(t, kind)
+		_, other := generateTestKey(t, kind)
+
+		sig, err := SignCatalog(data, private)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+
+		if err = VerifyCatalog(data, sig, [][]byte{public}); err != nil {
+			t.Errorf("%s: %v", kind, err)
+		}
+		if err = VerifyCatalog(data, sig, [][]byte{other, public}); err != nil {
+			t.Errorf("%s: second key not tried: %v", kind, err)
+		}
+		if err = VerifyCatalog(data, sig, [][]byte{other}); err == nil {
+			t.Errorf("%s: verified with the wrong key", kind)
+		}
+		if err = VerifyCatalog(append(data, '#'), sig, [][]byte{public}); err == nil {
+			t.Errorf("%s: verified tampered data", kind)
+		}
+	}
+}
+
+func TestGetExternalCatalogVerifiesSignature(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + catalogPath
+	keyPath := filepath.Join(dir, "key.pub")
+
+	private, public := generateTestKey(t, "ed25519")
+	os.WriteFile(keyPath, public, 0644)
+	sig, err := SignCatalog([]byte(testCatalog), private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name, catalog, sig string
+		allowUnsigned, ok  bool
+	}{
+		{"signed", testCatalog, string(sig), false, true},
+		{"tampered", testCatalog + "#", string(sig), false, false},
+		{"tampered but allowed", testCatalog + "#", string(sig), true, true},
+		{"unsigned", testCatalog, "", false, false},
+		{"unsigned but allowed", testCatalog, "", true, true},
+	}
+	Stderr = io.Discard
+	t.Cleanup(func() { Stderr = os.Stderr })
+
+	for _, test := range tests {
+		os.WriteFile(catalogPath, []byte(test.catalog), 0644)
+		os.Remove(catalogPath + SignatureSuffix)
+		if test.sig != "" {
+			os.WriteFile(catalogPath+SignatureSuffix, []byte(test.sig), 0644)
+		}
+
+		cm := MakeCatalogManager(dir)
+		cm.Options = map[string]CatalogOptions{uri: {PublicKeys: []string{keyPath}}}
+		cm.AllowUnsigned = test.allowUnsigned
+
+		_, err := cm.GetExternalCatalog(uri)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+// A catalog cached before its public keys were configured is fetched and
+// verified again rather than trusted
+func TestCachedCatalogVerifiedWithCurrentKeys(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := filepath.Join(dir, "catalog.yaml")
+	uri := "file://" + catalogPath
+	keyPath := filepath.Join(dir, "key.pub")
+	os.WriteFile(catalogPath, []byte(testCatalog), 0644)
+
+	private, public := generateTestKey(t, "ed25519")
+	os.WriteFile(keyPath, public, 0644)
+	Stderr = io.Discard
+	t.Cleanup(func() { Stderr = os.Stderr })
+
+	cache := func(cm *CatalogManager) {
+		files, err := cm.files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = replaceDir(cm.Directory, files); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cm := MakeCatalogManager(dir)
+	if err := cm.AddCatalog(uri); err != nil {
+		t.Fatal(err)
+	}
+	cache(&cm)
+
+	cm = MakeCatalogManager(dir)
+	cm.Options = map[string]CatalogOptions{uri: {PublicKeys: []string{keyPath}}}
+	if _, err := cm.GetCachedCatalog(uri); err == nil {
+		t.Fatal("unsigned cached catalog used after adding public keys")
+	}
+	cm.URIs = []string{uri}
+	cm.Load()
+	if _, ok := cm.Catalogs[uri]; ok {
+		t.Fatal("unsigned catalog loaded after adding public keys")
+	}
+
+	sig, err := SignCatalog([]byte(testCatalog), private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(catalogPath+SignatureSuffix, sig, 0644)
+	cm = MakeCatalogManager(dir)
+	cm.Options = map[string]CatalogOptions{uri: {PublicKeys: []string{keyPath}}}
+	if err := cm.AddCatalog(uri); err != nil {
+		t.Fatal(err)
+	}
+	cache(&cm)
+
+	cm = MakeCatalogManager(dir)
+	cm.Options = map[string]CatalogOptions{uri: {PublicKeys: []string{keyPath}}}
+	if _, err := cm.GetCachedCatalog(uri); err != nil {
+		t.Errorf("verified cached catalog: %v", err)
+	}
+
+	_, other := generateTestKey(t, "ed25519")
+	os.WriteFile(keyPath, other, 0644)
+	if _, err := cm.GetCachedCatalog(uri); err == nil {
+		t.Error("cached catalog used after its public key changed")
+	}
+}
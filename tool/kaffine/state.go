@@ -0,0 +1,45 @@
+package kaffine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// The installed functions as of the last save, so starting up does not need
+// to resolve every dependency in the config again
+type installedState struct {
+	// The config dependencies the functions were resolved from. The state is
+	// only used while they still match.
+	KrmFunctions []string                      `json:"krmFunctions"`
+	Functions    map[string]FunctionDefinition `json:"functions"`
+}
+
+func (fm *FunctionManager) statePath() string {
+	return filepath.Join(fm.Directory, "installed.json")
+}
+
+// The saved installed functions, if they are still what the config asks for
+func (fm *FunctionManager) readInstalledState() (map[string]FunctionDefinition, bool) {
+	data, err := os.ReadFile(fm.statePath())
+	if err != nil {
+		return nil, false
+	}
+
+	var state installedState
+	if err = json.Unmarshal(data, &state); err != nil || state.Functions == nil {
+		return nil, false
+	}
+	if !sameStrings(state.KrmFunctions, fm.Cfg.Dependencies.KrmFunctions) {
+		return nil, false
+	}
+
+	return state.Functions, true
+}
+
+func (fm *FunctionManager) marshalInstalledState() ([]byte, error) {
+	return json.Marshal(installedState{
+		KrmFunctions: fm.Cfg.Dependencies.KrmFunctions,
+		Functions:    fm.Installed,
+	})
+}
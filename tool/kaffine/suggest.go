@@ -0,0 +1,78 @@
+package kaffine
+
+import (
+	"sort"
+	"strings"
+)
+
+// Names of the functions closest to a misspelled name, best first
+func (cm *CatalogManager) Suggest(fname string, max int) (suggestions []string) {
+	cm.Load()
+	group, name, _ := ToGroupNameVersion(fname)
+	query := strings.ToLower(name)
+	if group != "" {
+		query = strings.ToLower(group + "/" + name)
+	}
+
+	type candidate struct {
+		groupName string
+		distance  int
+	}
+	var candidates []candidate
+	for groupName, fn := range cm.Functions {
+		target := strings.ToLower(fn.Names.Kind)
+		if group != "" {
+			target = strings.ToLower(groupName)
+		}
+
+		// Anything further away than a third of the name is noise
+		distance := editDistance(query, target)
+		if distance > len(query)/3+1 {
+			continue
+		}
+		candidates = append(candidates, candidate{groupName, distance})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].groupName < candidates[j].groupName
+	})
+
+	for i := 0; i < len(candidates) && i < max; i++ {
+		suggestions = append(suggestions, candidates[i].groupName)
+	}
+
+	return
+}
+
+// Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
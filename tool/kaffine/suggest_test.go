@@ -0,0 +1,23 @@
+package kaffine
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	var tests = []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"logger", "logger", 0},
+		{"loger", "logger", 1},
+		{"logger", "lgoger", 2},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, test := range tests {
+		if d := editDistance(test.a, test.b); d != test.distance {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, d, test.distance)
+		}
+	}
+}
@@ -1,37 +1,92 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"kaffine-mod/cmd/audit"
+	"kaffine-mod/cmd/catalog"
 	"kaffine-mod/cmd/config"
+	"kaffine-mod/cmd/history"
+	"kaffine-mod/cmd/info"
 	"kaffine-mod/cmd/install"
+	"kaffine-mod/cmd/licenses"
 	"kaffine-mod/cmd/list"
+	"kaffine-mod/cmd/outdated"
 	"kaffine-mod/cmd/remove"
+	"kaffine-mod/cmd/rollback"
+	"kaffine-mod/cmd/sbom"
 	"kaffine-mod/cmd/search"
 	"kaffine-mod/cmd/update"
 	"kaffine-mod/cmd/version"
 	"kaffine-mod/kaffine"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 func main() {
-	kaffine.InitializeGlobals()
-
 	var rootCmd = &cobra.Command{
 		Use:   "kaffine",
 		Short: "Kaffine is a KRM Function Manager",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := kaffine.ValidateOutputFormat(kaffine.OutputFormat); err != nil {
+				return err
+			}
+			if cmd.Annotations[kaffine.StandaloneCommand] == "true" {
+				return nil
+			}
+
+			mode := kaffine.ExclusiveLock
+			if cmd.Annotations[kaffine.ReadOnlyCommand] == "true" {
+				mode = kaffine.SharedLock
+			}
+
+			if err := kaffine.InitializeGlobals(mode); err != nil {
+				return err
+			}
+			kaffine.Fm.Operation = strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+
+			return nil
+		},
 	}
 
+	rootCmd.PersistentFlags().StringVarP(&kaffine.OutputFormat, "output", "o", kaffine.OutputFormat, "Output format, one of yaml|json|table|name|csv")
+	rootCmd.PersistentFlags().DurationVar(&kaffine.LockTimeout, "lock-timeout", kaffine.LockTimeout, "How long to wait for another kaffine process to finish")
+	rootCmd.PersistentFlags().BoolVar(&kaffine.AllowUnsigned, "allow-unsigned", false, "Use catalogs whose signature is missing or invalid, with a warning")
+
 	rootCmd.AddCommand(version.NewVersionCommand())
 	rootCmd.AddCommand(config.NewConfigCommand())
 	rootCmd.AddCommand(list.NewListCommand())
 	rootCmd.AddCommand(search.NewSearchCommand())
+	rootCmd.AddCommand(info.NewInfoCommand())
 	rootCmd.AddCommand(install.NewInstallCommand())
 	rootCmd.AddCommand(remove.NewRemoveCommand())
 	rootCmd.AddCommand(update.NewUpdateCommand())
+	rootCmd.AddCommand(outdated.NewOutdatedCommand())
+	rootCmd.AddCommand(history.NewHistoryCommand())
+	rootCmd.AddCommand(rollback.NewRollbackCommand())
+	rootCmd.AddCommand(catalog.NewCatalogCommand())
+	rootCmd.AddCommand(licenses.NewLicensesCommand())
+	rootCmd.AddCommand(sbom.NewSBOMCommand())
+	rootCmd.AddCommand(audit.NewAuditCommand())
 
 	rootErr := rootCmd.Execute()
 	if rootErr != nil {
+		var exitErr *kaffine.ExitError
+		if errors.As(rootErr, &exitErr) && exitErr.Save {
+			if err := kaffine.DestroyGlobals(); err != nil {
+				log.Fatalf("%v", err)
+			}
+		} else if kaffine.Fm != nil {
+			kaffine.Fm.Close()
+		}
+
+		if exitErr != nil {
+			fmt.Fprintln(os.Stderr, exitErr)
+			os.Exit(exitErr.Code)
+		}
 		log.Fatalf("kaffine encountered an error.\n%v\n", rootErr)
 	}
 